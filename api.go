@@ -1,16 +1,25 @@
 package regolt
 
 import (
+	"bufio"
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"log/slog"
+	"mime"
 	"mime/multipart"
 	"net/http"
+	"net/textproto"
 	"net/url"
+	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 )
 
 type Route struct {
@@ -558,13 +567,41 @@ type AutumnAPI struct {
 	HTTPClient HTTPClient
 	URL        *url.URL
 	Arshaler   JSONArshaler
+	// If true, uploads aren't checked against Autumn config before sending
+	DisableUploadValidation bool
+	// Requests are logged at debug level, nil disables logging
+	Logger *slog.Logger
+	ctx    context.Context
+	// shared between copies made by WithContext
+	config *autumnConfigCache
+}
+
+// WithContext returns a shallow copy of AutumnAPI whose requests are bound to ctx.
+// Example: `id, err := autumn.WithContext(ctx).Upload("attachments", "hello.txt", "", []byte("hello world"))`
+func (api *AutumnAPI) WithContext(ctx context.Context) *AutumnAPI {
+	if ctx == nil {
+		panic("nil context")
+	}
+	a := *api
+	a.ctx = ctx
+	return &a
+}
+
+// Context returns the context requests are bound to, context.Background() by default.
+func (api *AutumnAPI) Context() context.Context {
+	if api.ctx != nil {
+		return api.ctx
+	}
+	return context.Background()
 }
 
 // Requester config
 type AutumnAPIConfig struct {
-	HTTPClient HTTPClient
-	URL        *url.URL
-	Arshaler   JSONArshaler
+	HTTPClient              HTTPClient
+	URL                     *url.URL
+	Arshaler                JSONArshaler
+	DisableUploadValidation bool
+	Logger                  *slog.Logger
 }
 
 // NewAutumnAPI returns an AutumnAPI which can be used to upload and get files
@@ -584,10 +621,13 @@ func NewAutumnAPI(token *Token, config *AutumnAPIConfig) (api *AutumnAPI, err er
 		}
 	}
 	api = &AutumnAPI{
-		Token:      token,
-		HTTPClient: httpClient,
-		URL:        apiUrl,
-		Arshaler:   config.Arshaler,
+		Token:                   token,
+		HTTPClient:              httpClient,
+		URL:                     apiUrl,
+		Arshaler:                config.Arshaler,
+		DisableUploadValidation: config.DisableUploadValidation,
+		Logger:                  config.Logger,
+		config:                  &autumnConfigCache{},
 	}
 	return
 }
@@ -610,23 +650,11 @@ type internalArshaler interface {
 }
 
 func (api *AutumnAPI) marshal(v any) ([]byte, error) {
-	if api.Arshaler != nil {
-		b, err := api.Arshaler.Marshal(v)
-		if _, ok := err.(*ArshalNotImplemented); !ok {
-			return b, err
-		}
-	}
-	return json.Marshal(v)
+	return arshalMarshal(api.Arshaler, v)
 }
 
 func (api *AutumnAPI) unmarshal(d []byte, v any) error {
-	if api.Arshaler == nil {
-		err := api.Arshaler.Unmarshal(d, v)
-		if _, ok := err.(*ArshalNotImplemented); !ok {
-			return err
-		}
-	}
-	return json.Unmarshal(d, v)
+	return arshalUnmarshal(api.Arshaler, d, v)
 }
 
 func (api *AutumnAPI) Request(route Route, options *RequestOptions) (*http.Response, error) {
@@ -652,27 +680,38 @@ func (api *AutumnAPI) Request(route Route, options *RequestOptions) (*http.Respo
 		}
 		header.Set(h, api.Token.Token)
 	}
-	body := options.Body
-	if options.JSON != nil && body == nil {
+	var body io.Reader
+	if options.Body != nil {
+		body = options.Body
+	} else if options.JSON != nil {
 		if len(header.Get("Content-Type")) == 0 {
 			header.Set("Content-Type", "application/json")
 		}
-		b, err := json.Marshal(options.JSON)
+		b, err := api.marshal(options.JSON)
 		if err != nil {
 			return nil, err
 		}
-		body = io.NopCloser(bytes.NewReader(b))
+		body = bytes.NewReader(b)
 	}
 	u := api.URL.JoinPath(strings.TrimLeft(route.Path, "/"))
 	if options.QueryValues != nil {
 		u.RawQuery = options.QueryValues.Encode()
 	}
-	response, err := api.HTTPClient.Perform(&http.Request{
-		Method: route.Method,
-		URL:    u,
-		Body:   body,
-		Header: header,
-	})
+	ctx := options.Context
+	if ctx == nil {
+		ctx = api.Context()
+	}
+	request, err := http.NewRequestWithContext(ctx, route.Method, u.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	request.Header = header
+	if options.Body != nil && options.ContentLength > 0 {
+		request.ContentLength = options.ContentLength
+	}
+	start := time.Now()
+	response, err := api.HTTPClient.Perform(request)
+	logRequest(api.Logger, route, request, response, time.Since(start), err)
 	if err != nil {
 		return nil, err
 	}
@@ -689,8 +728,14 @@ func (api *AutumnAPI) RequestJSON(v any, route Route, options *RequestOptions) e
 	}
 	defer response.Body.Close()
 	if v != nil {
-		err = json.NewDecoder(response.Body).Decode(v)
-		if err != nil && !errors.Is(err, io.EOF) {
+		d, err := io.ReadAll(response.Body)
+		if err != nil {
+			return err
+		}
+		if len(d) == 0 {
+			return nil
+		}
+		if err = api.unmarshal(d, v); err != nil {
 			return err
 		}
 	}
@@ -727,32 +772,242 @@ func (api *AutumnAPI) FetchConfig() (c *AutumnConfig, err error) {
 	return
 }
 
+type autumnConfigCache struct {
+	mu     sync.Mutex
+	config *AutumnConfig
+}
+
+// Returns Autumn config, fetching it on first call. Returned config must not be modified.
+func (api *AutumnAPI) Config() (*AutumnConfig, error) {
+	if api.config == nil {
+		return api.FetchConfig()
+	}
+	api.config.mu.Lock()
+	c := api.config.config
+	api.config.mu.Unlock()
+	if c != nil {
+		return c, nil
+	}
+	// lock isn't held during request, so concurrent callers may fetch config at the same time
+	c, err := api.FetchConfig()
+	if err != nil {
+		return nil, err
+	}
+	api.config.mu.Lock()
+	api.config.config = c
+	api.config.mu.Unlock()
+	return c, nil
+}
+
+// Drops cached config, so next Config call fetches it again.
+func (api *AutumnAPI) InvalidateConfig() {
+	if api.config == nil {
+		return
+	}
+	api.config.mu.Lock()
+	defer api.config.mu.Unlock()
+	api.config.config = nil
+}
+
+type ErrUnknownTag struct {
+	Tag UploadTag
+}
+
+func (e ErrUnknownTag) Error() string {
+	return "unknown autumn tag: " + string(e.Tag)
+}
+
+type ErrTagDisabled struct {
+	Tag UploadTag
+}
+
+func (e ErrTagDisabled) Error() string {
+	return "autumn tag is disabled: " + string(e.Tag)
+}
+
+type ErrFileTooLarge struct {
+	Tag UploadTag
+	// Maximum size in bytes
+	Max int64
+	// Size of the file, or count of bytes read so far if size wasn't known in advance
+	Size int64
+}
+
+func (e ErrFileTooLarge) Error() string {
+	return "file too large for " + string(e.Tag) + ": " + strconv.FormatInt(e.Size, 10) + " bytes, max is " + strconv.FormatInt(e.Max, 10)
+}
+
+type ErrContentTypeNotAllowed struct {
+	Tag UploadTag
+	// AutumnTag.RestrictContentType, e.g. `Image`
+	Allowed string
+	// Sniffed content type
+	ContentType string
+}
+
+func (e ErrContentTypeNotAllowed) Error() string {
+	return "content type " + e.ContentType + " is not allowed for " + string(e.Tag) + ", only " + e.Allowed + " is allowed"
+}
+
+// Fails with ErrFileTooLarge once more than max bytes are read.
+type limitReader struct {
+	r    io.Reader
+	tag  UploadTag
+	max  int64
+	read int64
+}
+
+func (lr *limitReader) Read(p []byte) (int, error) {
+	n, err := lr.r.Read(p)
+	lr.read += int64(n)
+	if lr.read > lr.max {
+		return n, ErrFileTooLarge{Tag: lr.tag, Max: lr.max, Size: lr.read}
+	}
+	return n, err
+}
+
+// Checks upload against Autumn config and returns reader which must be used instead of r.
+// If config can't be fetched, validation is skipped and the server decides.
+func (api *AutumnAPI) validateUpload(tag UploadTag, r io.Reader, options *UploadOptions) (io.Reader, error) {
+	c, err := api.Config()
+	if err != nil {
+		if api.Logger != nil {
+			api.Logger.Warn("autumn config is unavailable, upload is not validated", slog.String("tag", string(tag)), slog.Any("err", err))
+		}
+		return r, nil
+	}
+	t, ok := c.Tags[string(tag)]
+	if !ok || t == nil {
+		return nil, ErrUnknownTag{Tag: tag}
+	}
+	if !t.Enabled {
+		return nil, ErrTagDisabled{Tag: tag}
+	}
+	if t.MaxSize > 0 {
+		max := int64(t.MaxSize)
+		if options.Size > max {
+			return nil, ErrFileTooLarge{Tag: tag, Max: max, Size: options.Size}
+		}
+		if options.Size <= 0 {
+			r = &limitReader{r: r, tag: tag, max: max}
+		}
+	}
+	if len(t.RestrictContentType) != 0 {
+		br := bufio.NewReaderSize(r, 512)
+		// error is reported when the body is read
+		head, _ := br.Peek(512)
+		ct := http.DetectContentType(head)
+		if !strings.HasPrefix(ct, strings.ToLower(t.RestrictContentType)+"/") {
+			return nil, ErrContentTypeNotAllowed{Tag: tag, Allowed: t.RestrictContentType, ContentType: ct}
+		}
+		r = br
+	}
+	return r, nil
+}
+
 // Upload file to Autumn.
 // tag [required] - tag, valid tags are: ["attachments", "avatars", "backgrounds", "banners", "emojis", "icons"]
 // filename [required] - filename that will displayed in client
 // contentType [optional, pass empty] - content type
 // contents [required] - the file contents
 // Example: `id, err := autumn.Upload("attachments", "hello.txt", "", []byte("hello world"))`
-func (api *AutumnAPI) Upload(tag UploadTag, filename, contentType string, contents []byte) (s string, err error) {
+func (api *AutumnAPI) Upload(tag UploadTag, filename, contentType string, contents []byte) (string, error) {
+	return api.UploadReader(tag, filename, bytes.NewReader(contents), &UploadOptions{
+		ContentType: contentType,
+		Size:        int64(len(contents)),
+	})
+}
+
+type UploadOptions struct {
+	// Content type of the file, `application/octet-stream` if empty
+	ContentType string
+	// Size of the file in bytes, 0 if unknown. When known, request is sent with Content-Length instead of chunked.
+	Size int64
+	// Called after each chunk of the file is sent with count of bytes sent so far and Size.
+	Progress func(sent, total int64)
+}
+
+type progressReader struct {
+	r        io.Reader
+	sent     int64
+	total    int64
+	progress func(sent, total int64)
+}
+
+func (pr *progressReader) Read(p []byte) (int, error) {
+	n, err := pr.r.Read(p)
+	if n > 0 {
+		pr.sent += int64(n)
+		pr.progress(pr.sent, pr.total)
+	}
+	return n, err
+}
+
+// Returns multipart body with single file part streamed from r, and its length or 0 if unknown.
+func multipartFileBody(field, filename string, r io.Reader, options *UploadOptions) (body io.Reader, length int64, contentType string, err error) {
 	buf := &bytes.Buffer{}
 	mpw := multipart.NewWriter(buf)
-	w, err := mpw.CreateFormFile("file", filename)
-	if err != nil {
+	ct := options.ContentType
+	if len(ct) == 0 {
+		ct = "application/octet-stream"
+	}
+	h := textproto.MIMEHeader{}
+	h.Set("Content-Disposition", mime.FormatMediaType("form-data", map[string]string{
+		"name":     field,
+		"filename": filename,
+	}))
+	h.Set("Content-Type", ct)
+	if _, err = mpw.CreatePart(h); err != nil {
 		return
 	}
-	_, err = w.Write(contents)
+	n := buf.Len()
+	// part is empty yet, so Close writes only the closing boundary after headers
+	if err = mpw.Close(); err != nil {
+		return
+	}
+	b := buf.Bytes()
+	if options.Progress != nil {
+		r = &progressReader{r: r, total: options.Size, progress: options.Progress}
+	}
+	body = io.MultiReader(bytes.NewReader(b[:n]), r, bytes.NewReader(b[n:]))
+	if options.Size > 0 {
+		length = int64(len(b)) + options.Size
+	}
+	contentType = mpw.FormDataContentType()
+	return
+}
+
+// Upload file to Autumn, streaming it from r without buffering the whole file in memory.
+// Unless DisableUploadValidation is set, the file is checked against Autumn config first and
+// ErrUnknownTag, ErrTagDisabled, ErrFileTooLarge or ErrContentTypeNotAllowed is returned.
+// Validation is skipped if config can't be fetched.
+// tag [required] - tag, valid tags are: ["attachments", "avatars", "backgrounds", "banners", "emojis", "icons"]
+// filename [required] - filename that will displayed in client
+// r [required] - the file contents
+// options [optional, pass nil] - content type, size and progress callback
+// Example: `id, err := autumn.UploadReader("attachments", "video.mp4", f, &regolt.UploadOptions{Size: stat.Size()})`
+func (api *AutumnAPI) UploadReader(tag UploadTag, filename string, r io.Reader, options *UploadOptions) (s string, err error) {
+	if options == nil {
+		options = &UploadOptions{}
+	}
+	if !api.DisableUploadValidation {
+		if r, err = api.validateUpload(tag, r, options); err != nil {
+			return
+		}
+	}
+	body, length, contentType, err := multipartFileBody("file", filename, r, options)
 	if err != nil {
 		return
 	}
 	h := http.Header{}
-	h.Set("Content-Type", mpw.FormDataContentType())
-	mpw.Close()
+	h.Set("Content-Type", contentType)
 	t := struct {
 		ID string `json:"id"`
 	}{}
 	err = api.RequestJSON(&t, AutumnRouteUpload(string(tag)), &RequestOptions{
-		Body:   io.NopCloser(buf),
-		Header: h,
+		Body:          io.NopCloser(body),
+		ContentLength: length,
+		Header:        h,
 	})
 	s = t.ID
 	return
@@ -763,29 +1018,180 @@ func (api *AutumnAPI) Upload(tag UploadTag, filename, contentType string, conten
 // id [required] - file ID
 // Example: `id, err := autumn.Get("attachments", "123")`
 func (api *AutumnAPI) Get(tag, id string) ([]byte, error) {
-	response, err := api.Request(AutumnRouteGet(tag, id), nil)
+	d, err := api.GetReader(tag, id, nil)
 	if err != nil {
 		return nil, err
 	}
-	defer response.Body.Close()
-	b, err := io.ReadAll(response.Body)
+	defer d.Body.Close()
+	b, err := io.ReadAll(d.Body)
 	if err != nil {
 		return nil, err
 	}
 	return b, nil
 }
 
+type GetFileOptions struct {
+	// Offset of the first byte to download, used to resume partial downloads
+	Offset int64
+	// Count of bytes to download, 0 to download until the end
+	Length int64
+}
+
+type AutumnDownload struct {
+	// File contents, must be closed by caller
+	Body io.ReadCloser
+	// Content type reported by Autumn
+	ContentType string
+	// Length of Body, -1 if unknown
+	ContentLength int64
+	// Filename from `Content-Disposition` header, empty if not present
+	Filename string
+	// Whether Body contains only requested range of the file
+	Partial bool
+	// Size of the whole file, -1 if unknown
+	TotalSize int64
+}
+
+// Parses `bytes 0-99/1234`, returns -1 if total size is unknown.
+func parseContentRangeTotal(s string) int64 {
+	i := strings.LastIndexByte(s, '/')
+	if i < 0 {
+		return -1
+	}
+	n, err := strconv.ParseInt(s[i+1:], 10, 64)
+	if err != nil {
+		return -1
+	}
+	return n
+}
+
+// Get file from Autumn without reading it into memory.
+// tag [required] - tag, valid tags are: ["attachments", "avatars", "backgrounds", "icons", "banners", "emojis"]
+// id [required] - file ID
+// options [optional, pass nil] - range of file to download
+// Example: `d, err := autumn.GetReader("attachments", "123", &regolt.GetFileOptions{Offset: written})`
+func (api *AutumnAPI) GetReader(tag, id string, options *GetFileOptions) (*AutumnDownload, error) {
+	if options == nil {
+		options = &GetFileOptions{}
+	}
+	h := http.Header{}
+	h.Set("Accept", "*/*")
+	if options.Offset > 0 || options.Length > 0 {
+		r := "bytes=" + strconv.FormatInt(options.Offset, 10) + "-"
+		if options.Length > 0 {
+			r += strconv.FormatInt(options.Offset+options.Length-1, 10)
+		}
+		h.Set("Range", r)
+	}
+	response, err := api.Request(AutumnRouteGet(tag, id), &RequestOptions{
+		Header:       h,
+		ManualAccept: true,
+	})
+	if err != nil {
+		return nil, err
+	}
+	d := &AutumnDownload{
+		Body:          response.Body,
+		ContentType:   response.Header.Get("Content-Type"),
+		ContentLength: response.ContentLength,
+		Partial:       response.StatusCode == http.StatusPartialContent,
+		TotalSize:     response.ContentLength,
+	}
+	if d.Partial {
+		d.TotalSize = parseContentRangeTotal(response.Header.Get("Content-Range"))
+	}
+	if _, params, err := mime.ParseMediaType(response.Header.Get("Content-Disposition")); err == nil {
+		d.Filename = params["filename"]
+	}
+	return d, nil
+}
+
+type AutumnURLOptions struct {
+	// Resize image so its longer side is at most MaxSide pixels, used by clients for avatars and icons
+	MaxSide int
+	// Resize image to Width x Height pixels
+	Width  int
+	Height int
+}
+
+// Returns URL of file in Autumn.
+// Example: `u := autumn.FileURL("avatars", user.Avatar.ID, &regolt.AutumnURLOptions{MaxSide: 256})`
+func (api *AutumnAPI) FileURL(tag, id string, options *AutumnURLOptions) string {
+	u := api.URL.JoinPath(strings.TrimLeft(AutumnRouteGet(tag, id).Path, "/"))
+	if options != nil {
+		v := url.Values{}
+		if options.MaxSide > 0 {
+			v.Set("max_side", strconv.Itoa(options.MaxSide))
+		}
+		if options.Width > 0 {
+			v.Set("width", strconv.Itoa(options.Width))
+		}
+		if options.Height > 0 {
+			v.Set("height", strconv.Itoa(options.Height))
+		}
+		u.RawQuery = v.Encode()
+	}
+	return u.String()
+}
+
+// Returns URL of f, see FileURL.
+func (api *AutumnAPI) AutumnFileURL(f *AutumnFile, options *AutumnURLOptions) string {
+	return api.FileURL(f.Tag, f.ID, options)
+}
+
+// Returns URL of f, see FileURL.
+func (api *AutumnAPI) OptimizedAutumnFileURL(f *OptimizedAutumnFile, options *AutumnURLOptions) string {
+	return api.FileURL(f.Tag, f.ID, options)
+}
+
 type API struct {
-	Token      *Token
-	HTTPClient HTTPClient
-	URL        *url.URL
-	Arshaler   JSONArshaler
+	Token       *Token
+	HTTPClient  HTTPClient
+	URL         *url.URL
+	Arshaler    JSONArshaler
+	RateLimiter RateLimiter
+	// How many times request is retried when Revolt responds with 429
+	MaxRetries int
+	// Used to upload files passed to SendMessageWithFiles
+	Autumn *AutumnAPI
+	// Requests are logged at debug level, nil disables logging
+	Logger *slog.Logger
+	ctx    context.Context
+}
+
+// WithContext returns a shallow copy of API whose requests are bound to ctx,
+// so every API method can be cancelled or given a deadline.
+// Example: `m, err := api.WithContext(ctx).SendMessage(channel, &regolt.SendMessage{Content: "Hello"})`
+func (api *API) WithContext(ctx context.Context) *API {
+	if ctx == nil {
+		panic("nil context")
+	}
+	a := *api
+	a.ctx = ctx
+	return &a
+}
+
+// Context returns the context requests are bound to, context.Background() by default.
+func (api *API) Context() context.Context {
+	if api.ctx != nil {
+		return api.ctx
+	}
+	return context.Background()
 }
 
 type APIConfig struct {
 	HTTPClient HTTPClient
 	URL        *url.URL
 	Arshaler   JSONArshaler
+	// Defaults to DefaultRateLimiter
+	RateLimiter        RateLimiter
+	DisableRateLimiter bool
+	// How many times request is retried when Revolt responds with 429, defaults to 3.
+	// Pass negative value to disable retrying.
+	MaxRetries int
+	// Defaults to AutumnAPI with the same token, HTTP client and logger
+	Autumn *AutumnAPI
+	Logger *slog.Logger
 }
 
 func NewAPI(token *Token, config *APIConfig) (api *API, err error) {
@@ -803,47 +1209,65 @@ func NewAPI(token *Token, config *APIConfig) (api *API, err error) {
 			return
 		}
 	}
+	rateLimiter := config.RateLimiter
+	if rateLimiter == nil && !config.DisableRateLimiter {
+		rateLimiter = NewDefaultRateLimiter()
+	}
+	maxRetries := config.MaxRetries
+	if maxRetries == 0 {
+		maxRetries = 3
+	} else if maxRetries < 0 {
+		maxRetries = 0
+	}
+	autumn := config.Autumn
+	if autumn == nil {
+		autumn, err = NewAutumnAPI(token, &AutumnAPIConfig{
+			HTTPClient: httpClient,
+			Arshaler:   config.Arshaler,
+			Logger:     config.Logger,
+		})
+		if err != nil {
+			return
+		}
+	}
 	api = &API{
-		Token:      token,
-		HTTPClient: httpClient,
-		URL:        apiUrl,
-		Arshaler:   config.Arshaler,
+		Token:       token,
+		HTTPClient:  httpClient,
+		URL:         apiUrl,
+		Arshaler:    config.Arshaler,
+		RateLimiter: rateLimiter,
+		MaxRetries:  maxRetries,
+		Autumn:      autumn,
+		Logger:      config.Logger,
 	}
 	return
 }
 
 func (api *API) marshal(v any) ([]byte, error) {
-	if api.Arshaler != nil {
-		b, err := api.Arshaler.Marshal(v)
-		if _, ok := err.(*ArshalNotImplemented); !ok {
-			return b, err
-		}
-	}
-	return json.Marshal(v)
+	return arshalMarshal(api.Arshaler, v)
 }
 
 func (api *API) unmarshal(d []byte, v any) error {
-	fmt.Println(string(d))
-	if api.Arshaler != nil {
-		err := api.Arshaler.Unmarshal(d, v)
-		if _, ok := err.(*ArshalNotImplemented); !ok {
-			return err
-		}
-	}
-	return json.Unmarshal(d, v)
+	return arshalUnmarshal(api.Arshaler, d, v)
 }
 
+// APIError wraps typed error for its Type (see errors.go), so it can be checked with errors.Is and errors.As.
 type APIError struct {
-	Response   *http.Response `json:"-"`
-	Type       string         `json:"type"`
-	RetryAfter float64        `json:"retry_after"`
-	Err        string         `json:"error"`
-	Max        int            `json:"max"`
-	Permission string         `json:"permission"`
-	Operation  string         `json:"operation"`
-	Collection string         `json:"collection"`
-	Location   string         `json:"location"`
-	With       string         `json:"with"`
+	Response *http.Response `json:"-"`
+	// HTTP status code of the response
+	StatusCode int `json:"-"`
+	// Raw response body
+	Body       []byte  `json:"-"`
+	Type       string  `json:"type"`
+	RetryAfter float64 `json:"retry_after"`
+	Err        string  `json:"error"`
+	Max        int     `json:"max"`
+	Permission string  `json:"permission"`
+	Operation  string  `json:"operation"`
+	Collection string  `json:"collection"`
+	Location   string  `json:"location"`
+	With       string  `json:"with"`
+	cause      error
 }
 
 func (ae APIError) Error() string {
@@ -869,14 +1293,27 @@ func (ae APIError) Error() string {
 	if len(ae.With) != 0 {
 		errs = append(errs, fmt.Sprintf("with: %s", ae.With))
 	}
+	typ := ae.Type
+	if len(typ) == 0 {
+		typ = "HTTP " + strconv.Itoa(ae.StatusCode)
+	}
 	if len(errs) == 0 {
-		return ae.Type
+		return typ
 	}
-	return ae.Type + ": " + strings.Join(errs, ", ")
+	return typ + ": " + strings.Join(errs, ", ")
+}
+
+// Returns typed error, e.g. ErrNotFound or ErrMissingPermission, nil if the type is unknown.
+func (ae APIError) Unwrap() error {
+	return ae.cause
 }
 
 type RequestOptions struct {
-	Body            io.ReadCloser
+	// Overrides context the requester is bound to
+	Context context.Context
+	Body    io.ReadCloser
+	// Length of Body in bytes, 0 if unknown
+	ContentLength   int64
 	JSON            any
 	Header          http.Header
 	Unauthenticated bool
@@ -884,10 +1321,64 @@ type RequestOptions struct {
 	QueryValues     url.Values
 }
 
+// Returns copy of h with tokens replaced.
+func redactHeader(h http.Header) http.Header {
+	r := h.Clone()
+	for _, k := range []string{"X-Bot-Token", "X-Session-Token", "Authorization"} {
+		if len(r.Values(k)) != 0 {
+			r.Set(k, "[REDACTED]")
+		}
+	}
+	return r
+}
+
+// Returns path segments which are credentials: webhook token and email verification code.
+func (route Route) secrets() []string {
+	a := strings.Split(route.Path, "/")
+	var r []string
+	for i, s := range a {
+		if len(s) != 0 && ((i == 3 && a[1] == "webhooks") || (i > 0 && a[i-1] == "verify")) {
+			r = append(r, s)
+		}
+	}
+	return r
+}
+
+// Replaces secrets in s.
+func redactSecrets(s string, secrets []string) string {
+	for _, secret := range secrets {
+		s = strings.ReplaceAll(s, secret, "[REDACTED]")
+	}
+	return s
+}
+
+func logRequest(logger *slog.Logger, route Route, request *http.Request, response *http.Response, duration time.Duration, err error) {
+	if logger == nil || !logger.Enabled(request.Context(), slog.LevelDebug) {
+		return
+	}
+	secrets := route.secrets()
+	attrs := []any{
+		slog.String("method", route.Method),
+		slog.String("route", redactSecrets(route.Path, secrets)),
+		slog.Duration("duration", duration),
+		slog.Any("header", redactHeader(request.Header)),
+	}
+	if err != nil {
+		// error may contain URL, e.g. *url.Error
+		logger.Debug("request failed", append(attrs, slog.String("err", redactSecrets(err.Error(), secrets)))...)
+		return
+	}
+	attrs = append(attrs, slog.Int("status", response.StatusCode))
+	if b := response.Header.Get("X-RateLimit-Bucket"); len(b) != 0 {
+		attrs = append(attrs, slog.String("bucket", b))
+	}
+	logger.Debug("request performed", attrs...)
+}
+
 func handleResponse(arshaler internalArshaler, response *http.Response) error {
 	if response.StatusCode >= 400 {
 		defer response.Body.Close()
-		e := APIError{Response: response}
+		e := APIError{Response: response, StatusCode: response.StatusCode}
 		t := struct {
 			Response   *http.Response `json:"-"`
 			Type       string         `json:"type"`
@@ -904,17 +1395,20 @@ func handleResponse(arshaler internalArshaler, response *http.Response) error {
 		if err != nil {
 			return err
 		}
-		if err := arshaler.unmarshal(d, &t); err != nil {
-			return err
+		e.Body = d
+		// body may be empty or not JSON, e.g. when a proxy responded, it is still available in Body
+		if len(d) != 0 {
+			_ = arshaler.unmarshal(d, &t)
 		}
+		var rocket *ErrRocket
 		switch v := t.Err.(type) {
 		case map[string]any: // Rocket error
 			tempCode, _ := v["code"].(float64)
-			code := int(tempCode)
 			reason, _ := v["reason"].(string)
 			description, _ := v["description"].(string)
+			rocket = &ErrRocket{Code: int(tempCode), Reason: reason, Description: description}
 			t.Type = "Rocket error"
-			e.Err = fmt.Sprintf("%d %s: %s", code, reason, description)
+			e.Err = rocket.Error()
 		case string: // Revolt error
 			e.Err = v
 		}
@@ -926,6 +1420,11 @@ func handleResponse(arshaler internalArshaler, response *http.Response) error {
 		e.Collection = t.Collection
 		e.Location = t.Location
 		e.With = t.With
+		if rocket != nil {
+			e.cause = *rocket
+		} else {
+			e.cause = e.variant()
+		}
 		return e
 	}
 	return nil
@@ -954,8 +1453,9 @@ func (api *API) Request(route Route, options *RequestOptions) (*http.Response, e
 		}
 		header.Set(h, api.Token.Token)
 	}
-	body := options.Body
-	if options.JSON != nil && body == nil {
+	// body can be sent again only if we own it
+	var payload []byte
+	if options.JSON != nil && options.Body == nil {
 		if len(header.Get("Content-Type")) == 0 {
 			header.Set("Content-Type", "application/json")
 		}
@@ -963,25 +1463,56 @@ func (api *API) Request(route Route, options *RequestOptions) (*http.Response, e
 		if err != nil {
 			return nil, err
 		}
-		body = io.NopCloser(bytes.NewReader(b))
+		payload = b
 	}
 	u := api.URL.JoinPath(strings.TrimLeft(route.Path, "/"))
 	if options.QueryValues != nil {
 		u.RawQuery = options.QueryValues.Encode()
 	}
-	response, err := api.HTTPClient.Perform(&http.Request{
-		Method: route.Method,
-		URL:    u,
-		Body:   body,
-		Header: header,
-	})
-	if err != nil {
-		return nil, err
+	ctx := options.Context
+	if ctx == nil {
+		ctx = api.Context()
 	}
-	if err = handleResponse(api, response); err != nil {
-		return nil, err
+	for i := 0; ; i++ {
+		var body io.Reader
+		if options.Body != nil {
+			body = options.Body
+		} else if payload != nil {
+			body = bytes.NewReader(payload)
+		}
+		if api.RateLimiter != nil {
+			if err := api.RateLimiter.Wait(ctx, route); err != nil {
+				return nil, err
+			}
+		}
+		request, err := http.NewRequestWithContext(ctx, route.Method, u.String(), body)
+		if err != nil {
+			return nil, err
+		}
+		request.Header = header
+		if options.Body != nil && options.ContentLength > 0 {
+			request.ContentLength = options.ContentLength
+		}
+		start := time.Now()
+		response, err := api.HTTPClient.Perform(request)
+		logRequest(api.Logger, route, request, response, time.Since(start), err)
+		if err != nil {
+			return nil, err
+		}
+		if api.RateLimiter != nil {
+			api.RateLimiter.Update(route, response.Header)
+		}
+		err = handleResponse(api, response)
+		if err == nil {
+			return response, nil
+		}
+		if response.StatusCode != http.StatusTooManyRequests || i >= api.MaxRetries || options.Body != nil {
+			return nil, err
+		}
+		if err = sleepContext(ctx, retryAfter(err, response.Header)); err != nil {
+			return nil, err
+		}
 	}
-	return response, nil
 }
 
 func (api *API) RequestJSON(v any, route Route, options *RequestOptions) error {
@@ -1735,6 +2266,118 @@ func (api *API) SendMessage(channel ULID, params *SendMessage) (m *Message, err
 	return
 }
 
+// File to be uploaded to Autumn.
+type File struct {
+	// Filename that will displayed in client
+	Name string
+	// Content type, sniffed from contents (or guessed from Name extension) if empty
+	ContentType string
+	// File contents. If nil, file at Path is opened and closed after upload.
+	Reader io.Reader
+	// Path to local file, used if Reader is nil
+	Path string
+	// Size in bytes, 0 if unknown. Filled automatically for Path.
+	Size int64
+}
+
+// Returns File which reads local file at path when uploaded.
+func NewLocalFile(path string) *File {
+	return &File{Name: filepath.Base(path), Path: path}
+}
+
+type FileUploadError struct {
+	Name string
+	Err  error
+}
+
+func (e FileUploadError) Error() string {
+	return "failed to upload " + e.Name + ": " + e.Err.Error()
+}
+
+func (e FileUploadError) Unwrap() error {
+	return e.Err
+}
+
+func (f *File) upload(autumn *AutumnAPI, tag UploadTag) (string, error) {
+	r, size := f.Reader, f.Size
+	if r == nil {
+		o, err := os.Open(f.Path)
+		if err != nil {
+			return "", err
+		}
+		defer o.Close()
+		if size <= 0 {
+			if stat, err := o.Stat(); err == nil {
+				size = stat.Size()
+			}
+		}
+		r = o
+	}
+	ct := f.ContentType
+	if len(ct) == 0 {
+		br := bufio.NewReaderSize(r, 512)
+		// error is reported when the body is read
+		head, _ := br.Peek(512)
+		ct = http.DetectContentType(head)
+		if ct == "application/octet-stream" {
+			if t := mime.TypeByExtension(filepath.Ext(f.Name)); len(t) != 0 {
+				ct = t
+			}
+		}
+		r = br
+	}
+	return autumn.UploadReader(tag, f.Name, r, &UploadOptions{ContentType: ct, Size: size})
+}
+
+// Returned by SendMessageWithFiles when API has no Autumn to upload files with.
+var ErrNoAutumn = errors.New("API.Autumn is nil")
+
+// Uploads files concurrently to `attachments` tag and sends message with them attached after params.Attachments.
+// If any upload fails, remaining uploads are cancelled, message isn't sent and FileUploadError is returned.
+// Files which were already uploaded aren't referenced by anything, so Autumn discards them.
+// params may be nil if message consists of files only.
+func (api *API) SendMessageWithFiles(channel ULID, params *SendMessage, files ...*File) (*Message, error) {
+	if api.Autumn == nil {
+		return nil, ErrNoAutumn
+	}
+	if params == nil {
+		params = &SendMessage{}
+	}
+	ctx, cancel := context.WithCancel(api.Context())
+	defer cancel()
+	autumn := api.Autumn.WithContext(ctx)
+	ids := make([]string, len(files))
+	errs := make([]error, len(files))
+	var wg sync.WaitGroup
+	for i, f := range files {
+		wg.Add(1)
+		go func(i int, f *File) {
+			defer wg.Done()
+			id, err := f.upload(autumn, UploadTagAttachments)
+			if err != nil {
+				errs[i] = FileUploadError{Name: f.Name, Err: err}
+				cancel()
+				return
+			}
+			ids[i] = id
+		}(i, f)
+	}
+	wg.Wait()
+	// prefer error which caused cancellation over context.Canceled of other uploads
+	var first error
+	for _, err := range errs {
+		if err != nil && (first == nil || errors.Is(first, context.Canceled)) {
+			first = err
+		}
+	}
+	if first != nil {
+		return nil, first
+	}
+	p := *params
+	p.Attachments = append(params.Attachments[:len(params.Attachments):len(params.Attachments)], ids...)
+	return api.SendMessage(channel, &p)
+}
+
 type SearchForMessages struct {
 	// Full-text search query
 	// See [MongoDB documentation](https://docs.mongodb.com/manual/text-search/#-text-operator) for more information.
@@ -2599,6 +3242,8 @@ type GloballyFetchMessages struct {
 	Author ULID `json:"author,omitempty"`
 	// Search query
 	Query string `json:"query,omitempty"`
+	// Whether to include user (and member, if server channel) objects
+	IncludeUsers bool `json:"include_users,omitempty"`
 }
 
 // This is a privileged route to globally fetch messages.
@@ -2609,9 +3254,9 @@ func (api *API) GloballyFetchMessages(params *GloballyFetchMessages) (m *Message
 	if err == nil {
 		if r[0] == '[' {
 			m = &Messages{}
-			err = json.Unmarshal(r, &m.Messages)
+			err = api.unmarshal(r, &m.Messages)
 		} else {
-			err = json.Unmarshal(r, &m)
+			err = api.unmarshal(r, &m)
 		}
 	}
 	return
@@ -0,0 +1,174 @@
+package regolt
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// Serves requests with handler instead of sending them.
+type testHTTPClient struct {
+	mu       sync.Mutex
+	requests []string
+	handler  func(r *http.Request) (int, string)
+}
+
+func (c *testHTTPClient) Perform(r *http.Request) (*http.Response, error) {
+	c.mu.Lock()
+	c.requests = append(c.requests, r.Method+" "+r.URL.Path)
+	c.mu.Unlock()
+	status, body := c.handler(r)
+	if r.Body != nil {
+		io.Copy(io.Discard, r.Body)
+	}
+	return &http.Response{
+		StatusCode: status,
+		Header:     http.Header{"Content-Type": {"application/json"}},
+		Body:       io.NopCloser(strings.NewReader(body)),
+		Request:    r,
+	}, nil
+}
+
+func TestAutumnUploadWithoutConfig(t *testing.T) {
+	hc := &testHTTPClient{handler: func(r *http.Request) (int, string) {
+		if r.Method == "GET" {
+			return 500, `{"type":"InternalError"}`
+		}
+		return 200, `{"id":"file"}`
+	}}
+	autumn, err := NewAutumnAPI(nil, &AutumnAPIConfig{HTTPClient: hc})
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, err := autumn.Upload("attachments", "hello.txt", "", []byte("hello world"))
+	if err != nil || id != "file" {
+		t.Fatalf("upload: %q, %v", id, err)
+	}
+	if want := []string{"GET /", "POST /attachments"}; strings.Join(hc.requests, ",") != strings.Join(want, ",") {
+		t.Fatalf("requests: %v", hc.requests)
+	}
+}
+
+func TestAutumnConfigCached(t *testing.T) {
+	hc := &testHTTPClient{handler: func(r *http.Request) (int, string) {
+		if r.Method == "GET" {
+			return 200, `{"autumn":"1","tags":{"attachments":{"max_size":5,"enabled":true}}}`
+		}
+		return 200, `{"id":"file"}`
+	}}
+	autumn, err := NewAutumnAPI(nil, &AutumnAPIConfig{HTTPClient: hc})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := autumn.Upload("attachments", "a.txt", "", []byte("abc")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := autumn.Upload("attachments", "b.txt", "", []byte("hello world")); err == nil {
+		t.Fatal("too large file was uploaded")
+	}
+	if want := []string{"GET /", "POST /attachments"}; strings.Join(hc.requests, ",") != strings.Join(want, ",") {
+		t.Fatalf("requests: %v", hc.requests)
+	}
+}
+
+func TestSendMessageWithFiles(t *testing.T) {
+	var mu sync.Mutex
+	contentTypes := map[string]string{}
+	var message string
+	hc := &testHTTPClient{handler: func(r *http.Request) (int, string) {
+		switch {
+		case r.URL.Host == "autumn.test" && r.Method == "GET":
+			return 500, `{"type":"InternalError"}`
+		case r.URL.Host == "autumn.test":
+			f, h, err := r.FormFile("file")
+			if err != nil {
+				t.Errorf("upload: %v", err)
+				return 400, `{}`
+			}
+			f.Close()
+			mu.Lock()
+			contentTypes[h.Filename] = h.Header.Get("Content-Type")
+			mu.Unlock()
+			return 200, `{"id":"` + h.Filename + `"}`
+		}
+		b, _ := io.ReadAll(r.Body)
+		message = string(b)
+		return 200, `{"_id":"m1","channel":"c1","author":"u1"}`
+	}}
+	autumnURL, _ := url.Parse("http://autumn.test/")
+	autumn, err := NewAutumnAPI(nil, &AutumnAPIConfig{HTTPClient: hc, URL: autumnURL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	apiURL, _ := url.Parse("http://api.test/")
+	api, err := NewAPI(nil, &APIConfig{HTTPClient: hc, URL: apiURL, DisableRateLimiter: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	api.Autumn = nil
+	if _, err := api.SendMessageWithFiles("c1", nil, &File{Name: "a.txt", Reader: strings.NewReader("hi")}); !errors.Is(err, ErrNoAutumn) {
+		t.Fatalf("without autumn: %v", err)
+	}
+	api.Autumn = autumn
+	_, err = api.SendMessageWithFiles("c1", nil,
+		&File{Name: "a.txt", Reader: strings.NewReader("hello")},
+		&File{Name: "b.png", Reader: strings.NewReader("\x89PNG\r\n\x1a\n")},
+		&File{Name: "c.json", Reader: strings.NewReader("\x00\x01")},
+		&File{Name: "d", ContentType: "x/y", Reader: strings.NewReader("hello")},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"a.txt":  "text/plain; charset=utf-8",
+		"b.png":  "image/png",
+		"c.json": "application/json",
+		"d":      "x/y",
+	}
+	if !reflect.DeepEqual(contentTypes, want) {
+		t.Fatalf("content types: %v", contentTypes)
+	}
+	if message != `{"attachments":["a.txt","b.png","c.json","d"]}` {
+		t.Fatalf("message: %s", message)
+	}
+}
+
+// Fails every request with error containing its URL, like http.Client does.
+type failingHTTPClient struct{}
+
+func (failingHTTPClient) Perform(r *http.Request) (*http.Response, error) {
+	return nil, &url.Error{Op: r.Method, URL: r.URL.String(), Err: errors.New("connection refused")}
+}
+
+func TestLogRequestRedactsSecrets(t *testing.T) {
+	hc := &testHTTPClient{handler: func(r *http.Request) (int, string) {
+		return 200, `{"_id":"m1","channel":"c1","author":"u1"}`
+	}}
+	for _, client := range []HTTPClient{hc, failingHTTPClient{}} {
+		buf := &bytes.Buffer{}
+		logger := slog.New(slog.NewTextHandler(buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+		api, err := NewAPI(NewBotToken("BOTSECRET"), &APIConfig{HTTPClient: client, Logger: logger, DisableRateLimiter: true, MaxRetries: -1})
+		if err != nil {
+			t.Fatal(err)
+		}
+		api.ExecuteWebhook("01HGJ1MBSC2JBQ0M0ZJ8R3M1W1", "WEBHOOKSECRET", &SendMessage{Content: "hi"})
+		api.FetchWebhook("01HGJ1MBSC2JBQ0M0ZJ8R3M1W1", "WEBHOOKSECRET")
+		api.VerifyEmail("CODESECRET")
+		out := buf.String()
+		if !strings.Contains(out, "/webhooks/01HGJ1MBSC2JBQ0M0ZJ8R3M1W1/[REDACTED]") {
+			t.Errorf("webhook route isn't logged:\n%s", out)
+		}
+		for _, secret := range []string{"WEBHOOKSECRET", "BOTSECRET", "CODESECRET"} {
+			if strings.Contains(out, secret) {
+				t.Errorf("%s is logged:\n%s", secret, out)
+			}
+		}
+	}
+}
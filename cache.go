@@ -1,5 +1,48 @@
 package regolt
 
+import (
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Caches are safe for concurrent use. Entities stored in them are treated as immutable:
+// Get and friends return shallow copies, and PartiallyUpdate replaces the stored entity with
+// an updated copy, so pointers obtained from the cache never change under the caller.
+// Nested pointers, slices and maps are shared between copies and must not be modified in place.
+
+// Counters of cache usage since creation or last ResetStats call.
+type CacheStats struct {
+	Hits        uint64
+	Misses      uint64
+	Evictions   uint64
+	Expirations uint64
+}
+
+type cacheCounters struct {
+	hits        atomic.Uint64
+	misses      atomic.Uint64
+	evictions   atomic.Uint64
+	expirations atomic.Uint64
+}
+
+func (cc *cacheCounters) stats() CacheStats {
+	return CacheStats{
+		Hits:        cc.hits.Load(),
+		Misses:      cc.misses.Load(),
+		Evictions:   cc.evictions.Load(),
+		Expirations: cc.expirations.Load(),
+	}
+}
+
+func (cc *cacheCounters) reset() {
+	cc.hits.Store(0)
+	cc.misses.Store(0)
+	cc.evictions.Store(0)
+	cc.expirations.Store(0)
+}
+
 type Cacheable interface {
 	GetKey() ULID
 }
@@ -14,61 +57,217 @@ type Cache1Checker[T Cacheable] interface {
 }
 
 type Cache1[T Cacheable] struct {
+	// Called without holding the cache lock, so it may use cache methods.
 	Checker              Cache1Checker[T]
 	DontInsertIfOverflow bool
 	MaxSize              int
-	Cache                map[ULID]*T
+	// Chooses which entity is evicted on overflow and which entities expire. If nil, arbitrary entity is evicted.
+	// Must not be changed after the cache is used.
+	Policy EvictionPolicy[ULID]
+	// Accessing Cache directly is not safe for concurrent use, use methods instead.
+	Cache    map[ULID]*T
+	mu       sync.RWMutex
+	counters cacheCounters
+}
+
+func snapshot[T any](v *T) *T {
+	if v == nil {
+		return nil
+	}
+	x := *v
+	return &x
+}
+
+func (c *Cache1[T]) canCache(e *T) bool {
+	return c.MaxSize <= 0 || c.Checker == nil || c.Checker.CanCache1(&Cache1CheckContext[T]{Cache: c, Entity: e})
+}
+
+func (c *Cache1[T]) del(id ULID) bool {
+	if _, ok := c.Cache[id]; !ok {
+		return false
+	}
+	delete(c.Cache, id)
+	if c.Policy != nil {
+		c.Policy.Removed(id)
+	}
+	return true
+}
+
+func (c *Cache1[T]) expire(now time.Time) {
+	if c.Policy == nil {
+		return
+	}
+	for _, k := range c.Policy.Expired(now) {
+		if c.del(k) {
+			c.counters.expirations.Add(1)
+		}
+	}
+}
+
+func (c *Cache1[T]) victim() (ULID, bool) {
+	if c.Policy != nil {
+		return c.Policy.Victim(nil)
+	}
+	for k := range c.Cache {
+		return k, true
+	}
+	return "", false
 }
 
 func (c *Cache1[T]) resize(e *T) bool {
 	if c.MaxSize == 0 {
 		return false
-	} else if c.MaxSize > 0 {
-		if c.Checker != nil && !c.Checker.CanCache1(&Cache1CheckContext[T]{Cache: c, Entity: e}) {
+	}
+	c.expire(time.Now())
+	// user wants infinite count of entities, if c.MaxSize is less than 0
+	if c.MaxSize < 0 {
+		return true
+	}
+	if _, ok := c.Cache[(*e).GetKey()]; ok {
+		return true
+	}
+	for len(c.Cache) >= c.MaxSize {
+		if c.DontInsertIfOverflow {
 			return false
 		}
-		if len(c.Cache) >= c.MaxSize {
-			if c.DontInsertIfOverflow {
-				return false
-			}
-			for k := range c.Cache {
-				delete(c.Cache, k)
-				break
-			}
+		k, ok := c.victim()
+		if !ok || !c.del(k) {
+			return false
 		}
-		c.Cache[(*e).GetKey()] = e
+		c.counters.evictions.Add(1)
 	}
-	// user wants infinite count of entities, if c.MaxSize is less than 0
 	return true
 }
 
+// Returns whether entity is cached and not expired. Expired entity is removed.
+// Must be called without holding the lock.
+func (c *Cache1[T]) alive(id ULID) bool {
+	if c.Policy == nil || c.Policy.Valid(id, time.Now()) {
+		return true
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.Policy.Valid(id, time.Now()) {
+		return true
+	}
+	if c.del(id) {
+		c.counters.expirations.Add(1)
+	}
+	return false
+}
+
+// Returns copy of entity or nil if it isn't cached.
 func (c *Cache1[T]) Get(id ULID) *T {
-	return c.Cache[id]
+	c.mu.RLock()
+	v := snapshot(c.Cache[id])
+	c.mu.RUnlock()
+	if v == nil || !c.alive(id) {
+		c.counters.misses.Add(1)
+		return nil
+	}
+	c.counters.hits.Add(1)
+	if c.Policy != nil {
+		c.Policy.Accessed(id)
+	}
+	return v
+}
+
+func (c *Cache1[T]) Has(id ULID) bool {
+	c.mu.RLock()
+	_, ok := c.Cache[id]
+	c.mu.RUnlock()
+	return ok && c.alive(id)
 }
 
 func (c *Cache1[T]) Del(id ULID) {
-	delete(c.Cache, id)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.del(id)
+}
+
+// Removes expired entities.
+func (c *Cache1[T]) Purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.expire(time.Now())
 }
 
+func (c *Cache1[T]) Stats() CacheStats {
+	return c.counters.stats()
+}
+
+func (c *Cache1[T]) ResetStats() {
+	c.counters.reset()
+}
+
+// Calls updater with copy of cached entity and stores the result. Updater must replace nested
+// pointers, slices and maps instead of modifying them.
 func (c *Cache1[T]) PartiallyUpdate(id ULID, updater func(m *T)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 	x, ok := c.Cache[id]
 	if !ok {
 		return
 	}
-	updater(x)
+	y := *x
+	updater(&y)
+	c.Cache[id] = &y
 }
 
+// The cache takes ownership of v, it must not be modified after call.
 func (c *Cache1[T]) Set(v *T) {
+	if !c.canCache(v) {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
 	if !c.resize(v) {
 		return
 	}
-	c.Cache[(*v).GetKey()] = v
+	k := (*v).GetKey()
+	c.Cache[k] = v
+	if c.Policy != nil {
+		c.Policy.Inserted(k)
+	}
 }
 
 func (c *Cache1[T]) Size() int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
 	return len(c.Cache)
 }
 
+// Returns IDs of all cached entities.
+func (c *Cache1[T]) Keys() []ULID {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	a := make([]ULID, 0, len(c.Cache))
+	for k := range c.Cache {
+		a = append(a, k)
+	}
+	return a
+}
+
+// Returns copies of all cached entities.
+func (c *Cache1[T]) Values() []*T {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	a := make([]*T, 0, len(c.Cache))
+	for _, v := range c.Cache {
+		a = append(a, snapshot(v))
+	}
+	return a
+}
+
+// Calls f for copy of each cached entity until it returns false. The cache isn't locked while f runs.
+func (c *Cache1[T]) Range(f func(*T) bool) {
+	for _, v := range c.Values() {
+		if !f(v) {
+			return
+		}
+	}
+}
+
 type Cache2CheckContext[T Cacheable] struct {
 	Cache  *Cache2[T]
 	Parent ULID
@@ -80,121 +279,315 @@ type Cache2Checker[T Cacheable] interface {
 }
 
 type Cache2[T Cacheable] struct {
+	// Called without holding the cache lock, so it may use cache methods.
 	Checker              Cache2Checker[T]
 	MaxSize1             int
 	MaxSize2             int
 	TotalMaxSize         int
 	total                int
 	DontInsertIfOverflow bool
-	Cache                map[ULID]map[ULID]*T
+	// Chooses which entity is evicted on overflow and which entities expire. If nil, arbitrary entity is evicted.
+	// When MaxSize1 is exceeded, whole group of the chosen entity is evicted.
+	// Must not be changed after the cache is used.
+	Policy EvictionPolicy[Cache2Key]
+	// Accessing Cache directly is not safe for concurrent use, use methods instead.
+	Cache    map[ULID]map[ULID]*T
+	mu       sync.RWMutex
+	counters cacheCounters
+}
+
+func (c *Cache2[T]) canCache(parent ULID, e *T) bool {
+	if c.Checker == nil || !(c.TotalMaxSize < 0 || c.MaxSize1 > 0) {
+		return true
+	}
+	return c.Checker.CanCache2(&Cache2CheckContext[T]{Cache: c, Parent: parent, Entity: e})
 }
 
-func (c *Cache2[T]) del(parent, id ULID) {
-	p := c.Cache[parent]
-	_, j := p[id]
+func (c *Cache2[T]) del(parent, id ULID) bool {
+	p, ok := c.Cache[parent]
+	if !ok {
+		return false
+	}
+	if _, ok = p[id]; !ok {
+		return false
+	}
 	delete(p, id)
-	if j {
-		c.total--
+	c.total--
+	if len(p) == 0 {
+		delete(c.Cache, parent)
+	}
+	if c.Policy != nil {
+		c.Policy.Removed(Cache2Key{parent, id})
 	}
+	return true
 }
 
-func (c *Cache2[T]) ins(parent ULID, e *T) {
+// Returns count of removed entities.
+func (c *Cache2[T]) delGroup(parent ULID) int {
 	m, ok := c.Cache[parent]
 	if !ok {
-		c.Cache[parent] = map[ULID]*T{(*e).GetKey(): e}
-		c.total++
-		return
+		return 0
 	}
+	c.total -= len(m)
+	delete(c.Cache, parent)
+	if c.Policy != nil {
+		for k := range m {
+			c.Policy.Removed(Cache2Key{parent, k})
+		}
+	}
+	return len(m)
+}
+
+func (c *Cache2[T]) ins(parent ULID, e *T) {
 	i := (*e).GetKey()
-	_, ok = m[i]
-	m[i] = e
+	m, ok := c.Cache[parent]
 	if !ok {
+		c.Cache[parent] = map[ULID]*T{i: e}
 		c.total++
+	} else {
+		_, ok = m[i]
+		m[i] = e
+		if !ok {
+			c.total++
+		}
+	}
+	if c.Policy != nil {
+		c.Policy.Inserted(Cache2Key{parent, i})
+	}
+}
+
+func (c *Cache2[T]) expire(now time.Time) {
+	if c.Policy == nil {
+		return
+	}
+	for _, k := range c.Policy.Expired(now) {
+		if c.del(k.Parent, k.ID) {
+			c.counters.expirations.Add(1)
+		}
 	}
 }
 
+func (c *Cache2[T]) victim(allow func(Cache2Key) bool) (Cache2Key, bool) {
+	if c.Policy != nil {
+		return c.Policy.Victim(allow)
+	}
+	for k1, v1 := range c.Cache {
+		for k2 := range v1 {
+			if k := (Cache2Key{k1, k2}); allow == nil || allow(k) {
+				return k, true
+			}
+		}
+	}
+	return Cache2Key{}, false
+}
+
+func (c *Cache2[T]) evict(allow func(Cache2Key) bool) bool {
+	if c.DontInsertIfOverflow {
+		return false
+	}
+	k, ok := c.victim(allow)
+	if !ok || !c.del(k.Parent, k.ID) {
+		return false
+	}
+	c.counters.evictions.Add(1)
+	return true
+}
+
 func (c *Cache2[T]) resize(parent ULID, e *T) bool {
-	switch {
-	case c.MaxSize1 == 0 && c.MaxSize2 == 0 && c.TotalMaxSize == 0:
+	if c.MaxSize1 == 0 && c.MaxSize2 == 0 && c.TotalMaxSize == 0 {
 		return false
-	case c.TotalMaxSize < 0 || c.MaxSize1 > 0:
-		if c.Checker != nil && !c.Checker.CanCache2(&Cache2CheckContext[T]{Cache: c, Parent: parent, Entity: e}) {
-			return false
+	}
+	c.expire(time.Now())
+	if _, ok := c.Cache[parent][(*e).GetKey()]; ok {
+		return true
+	}
+	if c.MaxSize2 > 0 {
+		inGroup := func(k Cache2Key) bool {
+			return k.Parent == parent
 		}
-		if c.MaxSize1 == 0 && c.MaxSize2 == 0 && c.total == c.TotalMaxSize {
-			if c.DontInsertIfOverflow {
+		for len(c.Cache[parent]) >= c.MaxSize2 {
+			if !c.evict(inGroup) {
 				return false
 			}
-			for k1, v1 := range c.Cache {
-				for k2 := range v1 {
-					c.del(k1, k2)
-					break
-				}
-			}
 		}
-		o, k := c.Cache[parent]
-		if k && c.MaxSize2 != 0 && len(o) >= c.MaxSize2 {
-			for k := range o {
-				c.del(parent, k)
-				return true
+	}
+	if c.MaxSize1 > 0 {
+		if _, ok := c.Cache[parent]; !ok {
+			for len(c.Cache) >= c.MaxSize1 {
+				if c.DontInsertIfOverflow {
+					return false
+				}
+				k, ok := c.victim(nil)
+				if !ok {
+					return false
+				}
+				c.counters.evictions.Add(uint64(c.delGroup(k.Parent)))
 			}
 		}
-		if c.MaxSize1 != 0 && len(c.Cache) >= c.MaxSize1 && !k {
-			for k := range c.Cache {
-				c.total -= len(c.Cache[k])
-				delete(c.Cache, k)
-				return true
+	}
+	if c.TotalMaxSize > 0 {
+		for c.total >= c.TotalMaxSize {
+			if !c.evict(nil) {
+				return false
 			}
 		}
 	}
 	return true
 }
 
+// Returns whether entity is cached and not expired. Expired entity is removed.
+// Must be called without holding the lock.
+func (c *Cache2[T]) alive(parent, id ULID) bool {
+	k := Cache2Key{parent, id}
+	if c.Policy == nil || c.Policy.Valid(k, time.Now()) {
+		return true
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.Policy.Valid(k, time.Now()) {
+		return true
+	}
+	if c.del(parent, id) {
+		c.counters.expirations.Add(1)
+	}
+	return false
+}
+
+// Returns copy of entity or nil if it isn't cached.
 func (c *Cache2[T]) Get(parent, id ULID) *T {
-	m, ok := c.Cache[parent]
-	if ok {
-		return m[id]
+	c.mu.RLock()
+	v := snapshot(c.Cache[parent][id])
+	c.mu.RUnlock()
+	if v == nil || !c.alive(parent, id) {
+		c.counters.misses.Add(1)
+		return nil
+	}
+	c.counters.hits.Add(1)
+	if c.Policy != nil {
+		c.Policy.Accessed(Cache2Key{parent, id})
 	}
-	return nil
+	return v
+}
+
+func (c *Cache2[T]) Has(parent, id ULID) bool {
+	c.mu.RLock()
+	_, ok := c.Cache[parent][id]
+	c.mu.RUnlock()
+	return ok && c.alive(parent, id)
 }
 
 func (c *Cache2[T]) Del(parent, id ULID) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 	c.del(parent, id)
 }
 
 func (c *Cache2[T]) DelGroup(parent ULID) {
-	m, ok := c.Cache[parent]
-	if ok {
-		c.total -= len(m)
-		delete(c.Cache, parent)
-	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.delGroup(parent)
+}
+
+// Removes expired entities.
+func (c *Cache2[T]) Purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.expire(time.Now())
+}
+
+func (c *Cache2[T]) Stats() CacheStats {
+	return c.counters.stats()
+}
+
+func (c *Cache2[T]) ResetStats() {
+	c.counters.reset()
 }
 
 func (c *Cache2[T]) GroupsCount() int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
 	return len(c.Cache)
 }
 
 func (c *Cache2[T]) Size() int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
 	return c.total
 }
 
+// Calls updater with copy of cached entity and stores the result. Updater must replace nested
+// pointers, slices and maps instead of modifying them.
 func (c *Cache2[T]) PartiallyUpdate(parent, id ULID, updater func(m *T)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 	x, ok := c.Cache[parent]
 	if !ok {
 		return
 	}
 	y, ok := x[id]
 	if ok {
-		updater(y)
+		z := *y
+		updater(&z)
+		x[id] = &z
 	}
 }
 
+// The cache takes ownership of v, it must not be modified after call.
 func (c *Cache2[T]) Set(parent ULID, v *T) {
+	if !c.canCache(parent, v) {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
 	if c.resize(parent, v) {
 		c.ins(parent, v)
 	}
 }
 
+// Returns parents of all groups.
+func (c *Cache2[T]) Groups() []ULID {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	a := make([]ULID, 0, len(c.Cache))
+	for k := range c.Cache {
+		a = append(a, k)
+	}
+	return a
+}
+
+// Returns IDs of cached entities in group.
+func (c *Cache2[T]) Keys(parent ULID) []ULID {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	m := c.Cache[parent]
+	a := make([]ULID, 0, len(m))
+	for k := range m {
+		a = append(a, k)
+	}
+	return a
+}
+
+// Returns copies of cached entities in group.
+func (c *Cache2[T]) Values(parent ULID) []*T {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	m := c.Cache[parent]
+	a := make([]*T, 0, len(m))
+	for _, v := range m {
+		a = append(a, snapshot(v))
+	}
+	return a
+}
+
+// Calls f for copy of each cached entity in group until it returns false. The cache isn't locked while f runs.
+func (c *Cache2[T]) Range(parent ULID, f func(*T) bool) {
+	for _, v := range c.Values(parent) {
+		if !f(v) {
+			return
+		}
+	}
+}
+
 func (c *Cache1[T]) init() {
 	if c.Cache == nil {
 		c.Cache = map[ULID]*T{}
@@ -240,6 +633,9 @@ func (gc *GenericCache) init() {
 	if gc.Users == nil {
 		gc.Users = &Cache1[OptimizedUser]{}
 	}
+	if gc.Webhooks == nil {
+		gc.Webhooks = &Cache1[OptimizedWebhook]{}
+	}
 
 	gc.Channels.init()
 	gc.Emojis.init()
@@ -248,6 +644,95 @@ func (gc *GenericCache) init() {
 	gc.Roles.init()
 	gc.Servers.init()
 	gc.Users.init()
+	gc.Webhooks.init()
+}
+
+type GenericCacheStats struct {
+	Channels CacheStats
+	Emojis   CacheStats
+	Messages CacheStats
+	Members  CacheStats
+	Roles    CacheStats
+	Servers  CacheStats
+	Users    CacheStats
+	Webhooks CacheStats
+}
+
+// Returns counters of every cache. Must be called after the cache was passed to NewSocket.
+func (gc *GenericCache) Stats() GenericCacheStats {
+	return GenericCacheStats{
+		Channels: gc.Channels.Stats(),
+		Emojis:   gc.Emojis.Stats(),
+		Messages: gc.Messages.Stats(),
+		Members:  gc.Members.Stats(),
+		Roles:    gc.Roles.Stats(),
+		Servers:  gc.Servers.Stats(),
+		Users:    gc.Users.Stats(),
+		Webhooks: gc.Webhooks.Stats(),
+	}
 }
 
 const InfiniteCache int = -1
+
+// Removes channel along with its messages and webhooks, and detaches it from its server.
+func (gc *GenericCache) deleteChannel(id ULID) {
+	if c := gc.Channels.Get(id); c != nil && len(c.Server) != 0 {
+		gc.Servers.PartiallyUpdate(c.Server, func(s *OptimizedServer) {
+			s.Channels = without(s.Channels, id)
+		})
+	}
+	gc.Channels.Del(id)
+	gc.Messages.DelGroup(id)
+	gc.Webhooks.Range(func(w *OptimizedWebhook) bool {
+		if w.ChannelID == id {
+			gc.Webhooks.Del(w.ID)
+		}
+		return true
+	})
+}
+
+// Removes server along with its channels, roles, members and emojis.
+func (gc *GenericCache) deleteServer(id ULID) {
+	if s := gc.Servers.Get(id); s != nil {
+		for _, c := range s.Channels {
+			gc.deleteChannel(c)
+		}
+	}
+	gc.Servers.Del(id)
+	gc.Roles.DelGroup(id)
+	gc.Members.DelGroup(id)
+	gc.Emojis.Range(func(e *OptimizedCustomEmoji) bool {
+		if e.Parent != nil && e.Parent.Type == OptimizedCustomEmojiParentTypeServer && e.Parent.ID == id {
+			gc.Emojis.Del(e.ID)
+		}
+		return true
+	})
+}
+
+// Removes role and all references to it from members and channels of the server.
+func (gc *GenericCache) deleteRole(server, id ULID) {
+	gc.Roles.Del(server, id)
+	for _, m := range gc.Members.Keys(server) {
+		gc.Members.PartiallyUpdate(server, m, func(m *Member) {
+			if slices.Contains(m.Roles, id) {
+				m.Roles = without(m.Roles, id)
+			}
+		})
+	}
+	if s := gc.Servers.Get(server); s != nil {
+		for _, c := range s.Channels {
+			gc.Channels.PartiallyUpdate(c, func(c *OptimizedChannel) {
+				if _, ok := c.RolePermissions[id]; !ok {
+					return
+				}
+				p := make(map[ULID]PermissionOverride, len(c.RolePermissions)-1)
+				for k, v := range c.RolePermissions {
+					if k != id {
+						p[k] = v
+					}
+				}
+				c.RolePermissions = p
+			})
+		}
+	}
+}
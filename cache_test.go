@@ -0,0 +1,116 @@
+package regolt
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Meant to be run with -race: socket updates cache while entities are read concurrently.
+func TestCacheConcurrentSocketUpdates(t *testing.T) {
+	socket := newTestSocket(t)
+	gc := socket.Cache
+	replay(socket,
+		`{"type":"Ready","users":[{"_id":"u1","username":"a","status":{"text":"hi","presence":"Online"},"profile":{"content":"bio"}}],
+		"servers":[],"channels":[],"members":[]}`,
+		`{"type":"ServerCreate","id":"s1","server":{"_id":"s1","owner":"u1","name":"server","channels":["c1"],
+		"roles":{"r1":{"name":"mod","permissions":{"a":0,"d":0},"rank":1}},"default_permissions":0},
+		"channels":[{"channel_type":"TextChannel","_id":"c1","server":"s1","name":"general"}],"emojis":[]}`,
+		`{"type":"ServerMemberJoin","id":"s1","user":"u1"}`,
+	)
+
+	const iterations = 300
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+
+	// slow listener which stays attached during updates
+	socket.OnUserUpdate(func(*UserUpdate) {
+		time.Sleep(time.Millisecond)
+	})
+	// listeners come and go while events are emitted
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < iterations; i++ {
+			sub := socket.OnUserUpdate(func(u *UserUpdate) {
+				_ = u.Data
+			})
+			sub.Delete()
+		}
+	}()
+
+	for r := 0; r < 4; r++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				if u := gc.Users.Get("u1"); u != nil && u.Status != nil {
+					_ = u.Status.Text + u.Username
+				}
+				for _, u := range gc.Users.Values() {
+					if u.Profile != nil {
+						_ = u.Profile.Content
+					}
+				}
+				for _, m := range gc.Members.Values("s1") {
+					_ = len(m.Roles)
+				}
+				gc.Members.Range("s1", func(m *Member) bool {
+					_ = m.Nickname
+					return true
+				})
+				gc.Channels.Range(func(c *OptimizedChannel) bool {
+					_ = c.Name
+					return true
+				})
+				gc.Servers.Range(func(s *OptimizedServer) bool {
+					_ = len(s.Channels)
+					return true
+				})
+				for _, m := range gc.Messages.Values("c1") {
+					_ = m.Content
+				}
+				_ = gc.Roles.Values("s1")
+				_ = gc.Stats()
+			}
+		}()
+	}
+
+	for i := 0; i < iterations; i++ {
+		n := strconv.Itoa(i)
+		replay(socket,
+			`{"type":"UserUpdate","id":"u1","data":{"username":"a`+n+`","status":{"text":"status `+n+`"}},"clear":[]}`,
+			`{"type":"ServerMemberUpdate","id":{"server":"s1","user":"u1"},"data":{"nickname":"n`+n+`","roles":["r1"]},"clear":[]}`,
+			`{"type":"ChannelUpdate","id":"c1","data":{"name":"general`+n+`"},"clear":[]}`,
+			`{"type":"Message","_id":"m`+n+`","channel":"c1","author":"u1","content":"`+n+`"}`,
+			`{"type":"ChannelCreate","channel_type":"TextChannel","_id":"c`+n+`x","server":"s1","name":"x"}`,
+			`{"type":"ChannelDelete","id":"c`+n+`x"}`,
+		)
+	}
+	close(done)
+	wg.Wait()
+
+	// cache updates are applied synchronously, so the last update wins even while listeners are attached
+	last := strconv.Itoa(iterations - 1)
+	if u := gc.Users.Get("u1"); u.Username != "a"+last || u.Status == nil || u.Status.Text != "status "+last {
+		t.Fatalf("user after updates: %+v", u)
+	}
+	if m := gc.Members.Get("s1", "u1"); m.Nickname != "n"+last {
+		t.Fatalf("member after updates: %+v", m)
+	}
+	if c := gc.Channels.Get("c1"); c.Name != "general"+last {
+		t.Fatalf("channel after updates: %+v", c)
+	}
+	if keys := gc.Channels.Keys(); len(keys) != 1 {
+		t.Fatalf("channels after updates: %v", keys)
+	}
+	if s := gc.Servers.Get("s1"); len(s.Channels) != 1 {
+		t.Fatalf("server channels after updates: %v", s.Channels)
+	}
+}
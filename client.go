@@ -0,0 +1,256 @@
+package regolt
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+type fetchCall struct {
+	done chan struct{}
+	v    any
+	err  error
+}
+
+// Collapses concurrent fetches of the same entity into a single request.
+type fetchGroup struct {
+	mu    sync.Mutex
+	calls map[string]*fetchCall
+}
+
+func isContextError(err error) bool {
+	return errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)
+}
+
+// Waiters stop waiting when ctx is done. If the request failed because context of the caller which started
+// it was done, waiters retry with their own f.
+func (g *fetchGroup) do(ctx context.Context, key string, f func() (any, error)) (any, error) {
+	for {
+		g.mu.Lock()
+		c, ok := g.calls[key]
+		if !ok {
+			if g.calls == nil {
+				g.calls = map[string]*fetchCall{}
+			}
+			c = &fetchCall{done: make(chan struct{})}
+			g.calls[key] = c
+			g.mu.Unlock()
+			return g.lead(key, c, f)
+		}
+		g.mu.Unlock()
+		select {
+		case <-c.done:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		if c.err == nil || !isContextError(c.err) || ctx.Err() != nil {
+			return c.v, c.err
+		}
+	}
+}
+
+func (g *fetchGroup) lead(key string, c *fetchCall, f func() (any, error)) (any, error) {
+	defer func() {
+		g.mu.Lock()
+		delete(g.calls, key)
+		g.mu.Unlock()
+		close(c.done)
+	}()
+	c.v, c.err = f()
+	return c.v, c.err
+}
+
+// Client combines API and socket cache: GetOrFetch methods return cached entity if there is one,
+// otherwise fetch it via REST and populate the cache. Concurrent fetches of the same entity
+// are performed once and their result is shared.
+type Client struct {
+	API   *API
+	Cache *GenericCache
+	group *fetchGroup
+}
+
+// Usually cache is `socket.Cache`.
+func NewClient(api *API, cache *GenericCache) *Client {
+	if cache == nil {
+		cache = &GenericCache{}
+	}
+	cache.init()
+	return &Client{
+		API:   api,
+		Cache: cache,
+		group: &fetchGroup{},
+	}
+}
+
+// Returns copy of client which performs requests with ctx.
+// When several callers wait for the same entity, each of them stops waiting once its own context is done.
+func (c *Client) WithContext(ctx context.Context) *Client {
+	return &Client{
+		API:   c.API.WithContext(ctx),
+		Cache: c.Cache,
+		group: c.group,
+	}
+}
+
+// Context of API, callers waiting for the same entity stop waiting once it is done.
+func (c *Client) context() context.Context {
+	if c.API != nil {
+		return c.API.Context()
+	}
+	return context.Background()
+}
+
+func getOrFetch[T any](c *Client, key string, get func() *T, fetch func() (*T, error)) (*T, error) {
+	if v := get(); v != nil {
+		return v, nil
+	}
+	v, err := c.group.do(c.context(), key, func() (any, error) {
+		// entity could be cached while we were waiting for the lock
+		if v := get(); v != nil {
+			return v, nil
+		}
+		return fetch()
+	})
+	if err != nil {
+		return nil, err
+	}
+	return snapshot(v.(*T)), nil
+}
+
+func (c *Client) GetOrFetchUser(user ULID) (*OptimizedUser, error) {
+	return getOrFetch(c, "users/"+string(user), func() *OptimizedUser {
+		return c.Cache.Users.Get(user)
+	}, func() (*OptimizedUser, error) {
+		u, err := c.API.FetchUser(user)
+		if err != nil {
+			return nil, err
+		}
+		o := u.ToOptimized()
+		c.Cache.Users.Set(snapshot(o))
+		return o, nil
+	})
+}
+
+func (c *Client) GetOrFetchChannel(channel ULID) (*OptimizedChannel, error) {
+	return getOrFetch(c, "channels/"+string(channel), func() *OptimizedChannel {
+		return c.Cache.Channels.Get(channel)
+	}, func() (*OptimizedChannel, error) {
+		ch, err := c.API.FetchChannel(channel)
+		if err != nil {
+			return nil, err
+		}
+		o := ch.ToOptimized()
+		c.Cache.Channels.Set(snapshot(o))
+		return o, nil
+	})
+}
+
+// Fetched server's roles are cached too.
+func (c *Client) GetOrFetchServer(server ULID) (*OptimizedServer, error) {
+	return getOrFetch(c, "servers/"+string(server), func() *OptimizedServer {
+		return c.Cache.Servers.Get(server)
+	}, func() (*OptimizedServer, error) {
+		s, err := c.API.FetchServer(server)
+		if err != nil {
+			return nil, err
+		}
+		o := s.ToOptimized()
+		c.Cache.Servers.Set(snapshot(o))
+		for i, r := range s.Roles {
+			c.Cache.Roles.Set(s.ID, r.ToOptimized(i))
+		}
+		return o, nil
+	})
+}
+
+// Returns roles of server. If none of them are cached, server is fetched and its roles are cached.
+func (c *Client) GetOrFetchRoles(server ULID) (map[ULID]*OptimizedRole, error) {
+	roles := map[ULID]*OptimizedRole{}
+	for _, r := range c.Cache.Roles.Values(server) {
+		roles[r.ID] = r
+	}
+	if len(roles) != 0 {
+		return roles, nil
+	}
+	v, err := c.group.do(c.context(), "servers/"+string(server)+"/roles", func() (any, error) {
+		s, err := c.API.FetchServer(server)
+		if err != nil {
+			return nil, err
+		}
+		c.Cache.Servers.Set(s.ToOptimized())
+		for i, r := range s.Roles {
+			o := r.ToOptimized(i)
+			roles[i] = o
+			c.Cache.Roles.Set(s.ID, snapshot(o))
+		}
+		return roles, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return v.(map[ULID]*OptimizedRole), nil
+}
+
+func (c *Client) GetOrFetchMember(server, member ULID) (*Member, error) {
+	return getOrFetch(c, "servers/"+string(server)+"/members/"+string(member), func() *Member {
+		return c.Cache.Members.Get(server, member)
+	}, func() (*Member, error) {
+		m, err := c.API.FetchMember(server, member)
+		if err != nil {
+			return nil, err
+		}
+		c.Cache.Members.Set(server, snapshot(m))
+		return m, nil
+	})
+}
+
+// Same as GenericCache.ComputePermissions, but missing entities are fetched. User who isn't member
+// of the server has no permissions in it.
+func (c *Client) ComputePermissions(user, server, channel ULID) (Permissions, error) {
+	q := &PermissionsQuery{User: user}
+	if len(channel) != 0 {
+		ch, err := c.GetOrFetchChannel(channel)
+		if err != nil {
+			return 0, err
+		}
+		q.Channel = ch
+		if len(ch.Server) != 0 {
+			server = ch.Server
+		}
+	}
+	if len(server) == 0 {
+		return ComputePermissions(q), nil
+	}
+	s, err := c.GetOrFetchServer(server)
+	if err != nil {
+		return 0, err
+	}
+	q.Server = s
+	m, err := c.GetOrFetchMember(server, user)
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		return 0, err
+	}
+	q.Member = m
+	q.Roles = map[ULID]*OptimizedRole{}
+	for _, r := range c.Cache.Roles.Values(server) {
+		q.Roles[r.ID] = r
+	}
+	if m != nil {
+		for _, id := range m.Roles {
+			if _, ok := q.Roles[id]; ok {
+				continue
+			}
+			// roles aren't cached, take them from the server object
+			raw, err := c.API.FetchServer(server)
+			if err != nil {
+				return 0, err
+			}
+			for i, r := range raw.Roles {
+				q.Roles[i] = r.ToOptimized(i)
+				c.Cache.Roles.Set(server, r.ToOptimized(i))
+			}
+			break
+		}
+	}
+	return ComputePermissions(q), nil
+}
@@ -0,0 +1,76 @@
+package regolt
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestFetchGroupWaiterContext(t *testing.T) {
+	g := &fetchGroup{}
+	started := make(chan struct{})
+	release := make(chan struct{})
+	go g.do(context.Background(), "k", func() (any, error) {
+		close(started)
+		<-release
+		return 1, nil
+	})
+	defer close(release)
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	done := make(chan error, 1)
+	go func() {
+		_, err := g.do(ctx, "k", func() (any, error) {
+			t.Error("waiter started own request")
+			return nil, nil
+		})
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("waiter error: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("waiter ignored its context")
+	}
+}
+
+func TestFetchGroupRetryAfterLeaderCancelled(t *testing.T) {
+	g := &fetchGroup{}
+	started := make(chan struct{})
+	release := make(chan struct{})
+	leader := make(chan error, 1)
+	go func() {
+		_, err := g.do(context.Background(), "k", func() (any, error) {
+			close(started)
+			<-release
+			return nil, context.Canceled
+		})
+		leader <- err
+	}()
+	<-started
+
+	waiter := make(chan any, 1)
+	go func() {
+		v, err := g.do(context.Background(), "k", func() (any, error) {
+			return 2, nil
+		})
+		if err != nil {
+			t.Errorf("waiter error: %v", err)
+		}
+		waiter <- v
+	}()
+	// let waiter start waiting for leader
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+	if err := <-leader; !errors.Is(err, context.Canceled) {
+		t.Fatalf("leader error: %v", err)
+	}
+	if v := <-waiter; v != 2 {
+		t.Fatalf("waiter result: %v", v)
+	}
+}
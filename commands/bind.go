@@ -0,0 +1,246 @@
+package commands
+
+import (
+	"errors"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/DarpHome/regolt"
+)
+
+// Options of field, taken from `cmd` and `description` tags.
+type optionSpec struct {
+	Name        string
+	Description string
+	Required    bool
+	// consume the rest of input as is
+	Rest bool
+	Base int
+	// allowed values of string field
+	Choices []string
+	// pattern string field must match
+	Pattern *regexp.Regexp
+}
+
+var (
+	ulidType     = reflect.TypeOf(regolt.ULID(""))
+	userType     = reflect.TypeOf((*regolt.OptimizedUser)(nil))
+	memberType   = reflect.TypeOf((*regolt.Member)(nil))
+	channelType  = reflect.TypeOf((*regolt.OptimizedChannel)(nil))
+	roleType     = reflect.TypeOf((*regolt.OptimizedRole)(nil))
+	emojiType    = reflect.TypeOf(regolt.Emoji{})
+	durationType = reflect.TypeOf(time.Duration(0))
+	timeType     = reflect.TypeOf(time.Time{})
+)
+
+// Parses `cmd:"name,required,rest,base=16,choices=a|b,pattern=..."` tag. Pattern must be the last one,
+// as it may contain commas. Name defaults to field name with lowercased first letter.
+func parseOptionSpec(f reflect.StructField) (*optionSpec, error) {
+	tag, ok := f.Tag.Lookup("cmd")
+	if tag == "-" {
+		return nil, nil
+	}
+	spec := &optionSpec{Description: f.Tag.Get("description")}
+	parts := strings.Split(tag, ",")
+	if ok {
+		spec.Name = parts[0]
+	}
+	if len(spec.Name) == 0 {
+		r := []rune(f.Name)
+		r[0] = unicode.ToLower(r[0])
+		spec.Name = string(r)
+	}
+	for i, p := range parts[1:] {
+		switch k, v, _ := strings.Cut(strings.TrimSpace(p), "="); k {
+		case "required":
+			spec.Required = true
+		case "rest":
+			spec.Rest = true
+		case "base":
+			b, err := strconv.Atoi(v)
+			if err != nil {
+				return nil, errors.New("field " + f.Name + " has invalid base: " + v)
+			}
+			spec.Base = b
+		case "choices":
+			spec.Choices = strings.Split(v, "|")
+		case "pattern":
+			_, v, _ = strings.Cut(strings.Join(parts[i+1:], ","), "=")
+			r, err := regexp.Compile(v)
+			if err != nil {
+				return nil, errors.New("field " + f.Name + " has invalid pattern: " + err.Error())
+			}
+			spec.Pattern = r
+			return spec, nil
+		default:
+			return nil, errors.New("field " + f.Name + " has unknown tag option: " + k)
+		}
+	}
+	return spec, nil
+}
+
+// Returns option which parses values of type t.
+func optionForType(t reflect.Type, spec *optionSpec) Option {
+	switch t {
+	case ulidType:
+		return ULIDOption{Name: spec.Name, Description: spec.Description, Required: spec.Required}
+	case userType:
+		return UserOption{Name: spec.Name, Description: spec.Description, Required: spec.Required}
+	case memberType:
+		return MemberOption{Name: spec.Name, Description: spec.Description, Required: spec.Required}
+	case channelType:
+		return ChannelOption{Name: spec.Name, Description: spec.Description, Required: spec.Required}
+	case roleType:
+		return RoleOption{Name: spec.Name, Description: spec.Description, Required: spec.Required}
+	case emojiType:
+		return EmojiOption{Name: spec.Name, Description: spec.Description, Required: spec.Required}
+	case durationType:
+		return DurationOption{Name: spec.Name, Description: spec.Description, Required: spec.Required}
+	case timeType:
+		return TimeOption{Name: spec.Name, Description: spec.Description, Required: spec.Required}
+	}
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return SignedIntOption{Name: spec.Name, Description: spec.Description, Base: spec.Base, BitSize: t.Bits(), Required: spec.Required}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return UnsignedIntOption{Name: spec.Name, Description: spec.Description, Base: spec.Base, BitSize: t.Bits(), Required: spec.Required}
+	case reflect.Bool:
+		return BoolOption{Name: spec.Name, Description: spec.Description, Required: spec.Required}
+	case reflect.Float32, reflect.Float64:
+		return FloatOption{Name: spec.Name, Description: spec.Description, BitSize: t.Bits(), Required: spec.Required}
+	case reflect.String:
+		if len(spec.Choices) != 0 {
+			return ChoiceOption{Name: spec.Name, Description: spec.Description, Choices: spec.Choices, Required: spec.Required}
+		}
+		if spec.Pattern != nil {
+			return RegexOption{Name: spec.Name, Description: spec.Description, Pattern: spec.Pattern, Required: spec.Required}
+		}
+		return StringOption{Name: spec.Name, Description: spec.Description, Raw: spec.Rest, Required: spec.Required}
+	case reflect.Slice:
+		// elements are required, so Greedy stops at the first value which isn't valid
+		elem := *spec
+		elem.Required = true
+		if o := optionForType(t.Elem(), &elem); o != nil {
+			if _, ok := o.(Greedy); !ok {
+				return Greedy{Option: o}
+			}
+		}
+	}
+	return nil
+}
+
+func sameKindClass(a, b reflect.Kind) bool {
+	class := func(k reflect.Kind) int {
+		switch {
+		case k >= reflect.Int && k <= reflect.Int64:
+			return 1
+		case k >= reflect.Uint && k <= reflect.Uintptr:
+			return 2
+		case k == reflect.Float32 || k == reflect.Float64:
+			return 3
+		case k == reflect.String:
+			return 4
+		}
+		return 0
+	}
+	return class(a) != 0 && class(a) == class(b)
+}
+
+// Assigns parsed option value to field, converting between types of the same kind (e.g. int64 to int8)
+// and element-wise for slices returned by Greedy.
+func assignOption(name string, dst reflect.Value, v any) error {
+	if v == nil {
+		return nil
+	}
+	rv := reflect.ValueOf(v)
+	t := dst.Type()
+	switch {
+	case rv.Type().AssignableTo(t):
+		dst.Set(rv)
+	case sameKindClass(rv.Kind(), t.Kind()):
+		dst.Set(rv.Convert(t))
+	case rv.Kind() == reflect.Slice && t.Kind() == reflect.Slice:
+		s := reflect.MakeSlice(t, rv.Len(), rv.Len())
+		for i := 0; i < rv.Len(); i++ {
+			if err := assignOption(name, s.Index(i), rv.Index(i).Interface()); err != nil {
+				return err
+			}
+		}
+		dst.Set(s)
+	default:
+		return OptionTypeMismatch{Name: name, Want: t, Got: rv.Type()}
+	}
+	return nil
+}
+
+type boundField struct {
+	index int
+	name  string
+}
+
+// Derives options of command from exported fields of struct T and sets callback which fills T with parsed
+// options before calling f. Options are parsed in order of fields and configured by tags:
+//
+//	type BanArgs struct {
+//		Target regolt.ULID `cmd:"target,required" description:"User to ban"`
+//		Days   int64       `cmd:"days"`
+//		Reason string      `cmd:",rest"`
+//	}
+//
+// Tag options are `required`, `rest` (string consumes the rest of input), `base=N` (for integers),
+// `choices=a|b|c` and `pattern=regexp` (for strings).
+// Fields of types *regolt.OptimizedUser, *regolt.Member, *regolt.OptimizedChannel, *regolt.OptimizedRole
+// and regolt.Emoji are resolved from mentions, IDs or names. Slice fields consume as many values as possible. Fields tagged with `cmd:"-"` are skipped.
+func Bind[T any](c *Command, f func(ctx *Context, args *T)) (*Command, error) {
+	t := reflect.TypeOf((*T)(nil)).Elem()
+	if t.Kind() != reflect.Struct {
+		return nil, errors.New("commands: Bind requires struct, got " + t.String())
+	}
+	var options []Option
+	var fields []boundField
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if !sf.IsExported() || sf.Anonymous {
+			continue
+		}
+		spec, err := parseOptionSpec(sf)
+		if err != nil {
+			return nil, err
+		}
+		if spec == nil {
+			continue
+		}
+		o := optionForType(sf.Type, spec)
+		if o == nil {
+			return nil, UnsupportedOptionType{Field: sf.Name, Type: sf.Type}
+		}
+		options = append(options, o)
+		fields = append(fields, boundField{index: i, name: spec.Name})
+	}
+	c.Options = options
+	c.Callback = func(ctx *Context) {
+		args := new(T)
+		v := reflect.ValueOf(args).Elem()
+		for _, bf := range fields {
+			if err := assignOption(bf.name, v.Field(bf.index), ctx.Options[bf.name]); err != nil {
+				ctx.Manager.emitError(ctx, err)
+				return
+			}
+		}
+		f(ctx, args)
+	}
+	return c, nil
+}
+
+// Same as Bind, but panics on error. Useful in command declarations.
+func MustBind[T any](c *Command, f func(ctx *Context, args *T)) *Command {
+	c, err := Bind(c, f)
+	if err != nil {
+		panic(err)
+	}
+	return c
+}
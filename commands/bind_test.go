@@ -0,0 +1,200 @@
+package commands
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/DarpHome/regolt"
+)
+
+func TestParseOptionSpec(t *testing.T) {
+	type fields struct {
+		Plain    int
+		Named    int    `cmd:"n" description:"Number"`
+		Flags    string `cmd:"flags, required ,rest"`
+		Hex      uint   `cmd:",base=16"`
+		Choice   string `cmd:"choice,choices=a|b|c"`
+		Pattern  string `cmd:"p,required,pattern=^[a-z]{1,3}(,[a-z]+)*$"`
+		Skipped  int    `cmd:"-"`
+		BadBase  int    `cmd:"x,base=z"`
+		BadRegex string `cmd:"x,pattern=("`
+		Unknown  string `cmd:"x,wat"`
+	}
+	tp := reflect.TypeOf(fields{})
+	for _, c := range []struct {
+		field string
+		want  *optionSpec
+		err   bool
+	}{
+		{"Plain", &optionSpec{Name: "plain"}, false},
+		{"Named", &optionSpec{Name: "n", Description: "Number"}, false},
+		{"Flags", &optionSpec{Name: "flags", Required: true, Rest: true}, false},
+		{"Hex", &optionSpec{Name: "hex", Base: 16}, false},
+		{"Choice", &optionSpec{Name: "choice", Choices: []string{"a", "b", "c"}}, false},
+		{"Skipped", nil, false},
+		{"BadBase", nil, true},
+		{"BadRegex", nil, true},
+		{"Unknown", nil, true},
+	} {
+		f, _ := tp.FieldByName(c.field)
+		got, err := parseOptionSpec(f)
+		if (err != nil) != c.err || !reflect.DeepEqual(got, c.want) {
+			t.Errorf("spec of %s: %+v, %v; want %+v", c.field, got, err, c.want)
+		}
+	}
+	// commas belong to pattern
+	f, _ := tp.FieldByName("Pattern")
+	spec, err := parseOptionSpec(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if spec.Name != "p" || !spec.Required || spec.Pattern == nil || spec.Pattern.String() != "^[a-z]{1,3}(,[a-z]+)*$" {
+		t.Fatalf("spec with pattern: %+v", spec)
+	}
+}
+
+func TestOptionForType(t *testing.T) {
+	spec := &optionSpec{Name: "o", Base: 8}
+	for _, c := range []struct {
+		v    any
+		want Option
+	}{
+		{int8(0), SignedIntOption{Name: "o", Base: 8, BitSize: 8}},
+		{uint32(0), UnsignedIntOption{Name: "o", Base: 8, BitSize: 32}},
+		{float32(0), FloatOption{Name: "o", BitSize: 32}},
+		{"", StringOption{Name: "o"}},
+		{regolt.ULID(""), ULIDOption{Name: "o"}},
+		// elements of slice are required
+		{[]int16{}, Greedy{Option: SignedIntOption{Name: "o", Base: 8, BitSize: 16, Required: true}}},
+		{[]regolt.ULID{}, Greedy{Option: ULIDOption{Name: "o", Required: true}}},
+		{[]*regolt.OptimizedUser{}, Greedy{Option: UserOption{Name: "o", Required: true}}},
+		// slices of slices and unknown types aren't supported
+		{[][]int{}, nil},
+		{map[string]int{}, nil},
+		{struct{}{}, nil},
+	} {
+		if got := optionForType(reflect.TypeOf(c.v), spec); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("option for %T: %#v, want %#v", c.v, got, c.want)
+		}
+	}
+}
+
+func TestAssignOption(t *testing.T) {
+	type name string
+	var (
+		i8  int8
+		u16 uint16
+		f32 float32
+		n   name
+		s   []int8
+		ids []regolt.ULID
+	)
+	for _, c := range []struct {
+		dst  any
+		v    any
+		want any
+	}{
+		{&i8, int64(-128), int8(-128)},
+		{&u16, uint64(65535), uint16(65535)},
+		{&f32, float64(1.5), float32(1.5)},
+		{&n, "x", name("x")},
+		{&s, []any{int64(1), int64(-2)}, []int8{1, -2}},
+		{&s, []any{}, []int8{}},
+		{&ids, []any{regolt.ULID("a"), regolt.ULID("b")}, []regolt.ULID{"a", "b"}},
+	} {
+		dst := reflect.ValueOf(c.dst).Elem()
+		if err := assignOption("o", dst, c.v); err != nil {
+			t.Fatalf("assigning %#v to %s: %v", c.v, dst.Type(), err)
+		}
+		if got := dst.Interface(); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("assigned %#v to %s: %#v, want %#v", c.v, dst.Type(), got, c.want)
+		}
+	}
+	// missing option leaves field zero
+	i8 = 0
+	if err := assignOption("o", reflect.ValueOf(&i8).Elem(), nil); err != nil || i8 != 0 {
+		t.Fatalf("assigning nil: %d, %v", i8, err)
+	}
+	var m OptionTypeMismatch
+	if err := assignOption("o", reflect.ValueOf(&i8).Elem(), "1"); !errors.As(err, &m) || m.Name != "o" || m.Want != reflect.TypeOf(i8) {
+		t.Fatalf("assigning string to int8: %v", err)
+	}
+	if err := assignOption("o", reflect.ValueOf(&s).Elem(), []any{int64(1), "2"}); !errors.As(err, &m) {
+		t.Fatalf("assigning mixed slice: %v", err)
+	}
+}
+
+type bindArgs struct {
+	Target  regolt.ULID `cmd:"target,required"`
+	Days    int8        `cmd:"days,required"`
+	Codes   []uint16    `cmd:"codes,base=16"`
+	Mode    string      `cmd:"mode,choices=soft|hard"`
+	Tags    string      `cmd:"tags,pattern=^[a-z]+(,[a-z]+)*$"`
+	Reason  string      `cmd:",rest"`
+	Ignored int         `cmd:"-"`
+	private int
+}
+
+func TestBind(t *testing.T) {
+	c := newTestCommands(t, &testHTTPClient{})
+	var got *bindArgs
+	cmd := MustBind(&Command{Name: "ban"}, func(ctx *Context, args *bindArgs) {
+		got = args
+	})
+	var names []string
+	for _, o := range cmd.Options {
+		names = append(names, o.GetName())
+	}
+	if want := []string{"target", "days", "codes", "mode", "tags", "reason"}; !reflect.DeepEqual(names, want) {
+		t.Fatalf("options: %v, want %v", names, want)
+	}
+	c.Register(cmd)
+	var errs []error
+	c.OnError(func(e *CommandError) {
+		errs = append(errs, e.Err)
+	})
+	run := func(args string) {
+		got, errs = nil, nil
+		ctx := testContext(c, "someone", args)
+		ctx.Label = "ban"
+		c.Handle(ctx)
+	}
+
+	run("01aryz6s41tsv4rrffq69g5fav -128 ff 1A hard a,b spam  and more")
+	want := &bindArgs{Target: "01ARYZ6S41TSV4RRFFQ69G5FAV", Days: -128, Codes: []uint16{0xff, 0x1a}, Mode: "hard", Tags: "a,b", Reason: "spam  and more"}
+	if len(errs) != 0 || !reflect.DeepEqual(got, want) {
+		t.Fatalf("args: %+v, errors %v; want %+v", got, errs, want)
+	}
+
+	// value doesn't fit into int8
+	run("01ARYZ6S41TSV4RRFFQ69G5FAV 128")
+	var invalid InvalidOption
+	if got != nil || len(errs) != 1 || !errors.As(errs[0], &invalid) || invalid.Name != "days" {
+		t.Fatalf("args: %+v, errors %v", got, errs)
+	}
+
+	run("")
+	if got != nil || len(errs) != 1 || !errors.As(errs[0], &OptionRequired{}) {
+		t.Fatalf("args: %+v, errors %v", got, errs)
+	}
+}
+
+func TestBindErrors(t *testing.T) {
+	if _, err := Bind(&Command{}, func(*Context, *int) {}); err == nil {
+		t.Error("bound int")
+	}
+	type unsupported struct {
+		M map[string]int
+	}
+	var uot UnsupportedOptionType
+	if _, err := Bind(&Command{}, func(*Context, *unsupported) {}); !errors.As(err, &uot) || uot.Field != "M" {
+		t.Errorf("bound map: %v", err)
+	}
+	type badTag struct {
+		N int `cmd:"n,base=x"`
+	}
+	if _, err := Bind(&Command{}, func(*Context, *badTag) {}); err == nil {
+		t.Error("bound field with invalid base")
+	}
+}
@@ -0,0 +1,259 @@
+package commands
+
+import (
+	"sync"
+	"time"
+
+	"github.com/DarpHome/regolt"
+)
+
+// Passes if all checks pass, returns error of the first failed one.
+func All(checks ...Check) Check {
+	return func(ctx *Context) error {
+		for _, check := range checks {
+			if err := check(ctx); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// Passes if at least one check passes, returns error of the last failed one otherwise.
+func Any(checks ...Check) Check {
+	return func(ctx *Context) (err error) {
+		for _, check := range checks {
+			if err = check(ctx); err == nil {
+				return nil
+			}
+		}
+		return
+	}
+}
+
+// Passes only in server channels.
+func ServerOnly() Check {
+	return func(ctx *Context) error {
+		server, err := ctx.CurrentServer()
+		if err != nil {
+			return err
+		}
+		if len(server) == 0 {
+			return NotInServer{}
+		}
+		return nil
+	}
+}
+
+// Passes only in direct messages and groups.
+func PrivateOnly() Check {
+	return func(ctx *Context) error {
+		server, err := ctx.CurrentServer()
+		if err != nil {
+			return err
+		}
+		if len(server) != 0 {
+			return NotInPrivateChannel{}
+		}
+		return nil
+	}
+}
+
+// Passes if author is one of owners. If no owners are given, owner of the bot is used.
+func OwnerOnly(owners ...regolt.ULID) Check {
+	return func(ctx *Context) error {
+		author := ctx.Message.Author
+		for _, o := range owners {
+			if o == author {
+				return nil
+			}
+		}
+		if len(owners) == 0 {
+			me, err := ctx.Manager.me()
+			if err != nil {
+				return err
+			}
+			if me.ID == author || (me.Bot != nil && me.Bot.Owner == author) {
+				return nil
+			}
+		}
+		return NotOwner{}
+	}
+}
+
+// Passes if author owns the server. Fails outside of servers.
+func ServerOwnerOnly() Check {
+	return func(ctx *Context) error {
+		server, err := ctx.CurrentServer()
+		if err != nil {
+			return err
+		}
+		if len(server) == 0 {
+			return NotInServer{}
+		}
+		s, err := ctx.Manager.client().GetOrFetchServer(server)
+		if err != nil {
+			return err
+		}
+		if s.Owner != ctx.Message.Author {
+			return NotOwner{}
+		}
+		return nil
+	}
+}
+
+// Passes if author has permissions in the channel, missing entities are fetched.
+func RequirePermissions(p regolt.Permissions) Check {
+	return func(ctx *Context) error {
+		has, err := ctx.Manager.client().ComputePermissions(ctx.Message.Author, "", ctx.Message.Channel)
+		if err != nil {
+			return err
+		}
+		if !has.Has(p) {
+			return MissingPermissions{Missing: p &^ has}
+		}
+		return nil
+	}
+}
+
+// Passes if bot has permissions in the channel, missing entities are fetched.
+func RequireBotPermissions(p regolt.Permissions) Check {
+	return func(ctx *Context) error {
+		me, err := ctx.Manager.me()
+		if err != nil {
+			return err
+		}
+		has, err := ctx.Manager.client().ComputePermissions(me.ID, "", ctx.Message.Channel)
+		if err != nil {
+			return err
+		}
+		if !has.Has(p) {
+			return BotMissingPermissions{Missing: p &^ has}
+		}
+		return nil
+	}
+}
+
+type BucketType int
+
+const (
+	// Cooldown applies to each user separately
+	BucketUser BucketType = iota
+	// Cooldown applies to each channel separately
+	BucketChannel
+	// Cooldown applies to each server separately, to channel outside of servers
+	BucketServer
+	// Cooldown applies to all invocations
+	BucketGlobal
+	// Cooldown applies to each user in each channel separately
+	BucketMember
+)
+
+func (bt BucketType) String() string {
+	switch bt {
+	case BucketUser:
+		return "user"
+	case BucketChannel:
+		return "channel"
+	case BucketServer:
+		return "server"
+	case BucketGlobal:
+		return "global"
+	case BucketMember:
+		return "member"
+	default:
+		return "unknown"
+	}
+}
+
+// Allows Rate (at least 1) invocations per Per in each bucket. Use it as check via Cooldown.Check
+// and place it after other checks, so failed invocations aren't counted.
+type Cooldown struct {
+	Rate   int
+	Per    time.Duration
+	Bucket BucketType
+	mu     sync.Mutex
+	// times of invocations within the last Per, oldest first
+	buckets map[string][]time.Time
+	calls   int
+}
+
+func NewCooldown(rate int, per time.Duration, bucket BucketType) *Cooldown {
+	return &Cooldown{Rate: rate, Per: per, Bucket: bucket}
+}
+
+func (cd *Cooldown) key(ctx *Context) (string, error) {
+	switch cd.Bucket {
+	case BucketUser:
+		return string(ctx.Message.Author), nil
+	case BucketChannel:
+		return string(ctx.Message.Channel), nil
+	case BucketServer:
+		server, err := ctx.CurrentServer()
+		if err != nil {
+			return "", err
+		}
+		if len(server) == 0 {
+			return string(ctx.Message.Channel), nil
+		}
+		return string(server), nil
+	case BucketMember:
+		return string(ctx.Message.Channel) + "/" + string(ctx.Message.Author), nil
+	default:
+		return "", nil
+	}
+}
+
+// Removes expired invocations, must be called with lock held.
+func (cd *Cooldown) prune(key string, now time.Time) []time.Time {
+	a := cd.buckets[key]
+	i := 0
+	for i < len(a) && now.Sub(a[i]) >= cd.Per {
+		i++
+	}
+	a = a[i:]
+	if len(a) == 0 {
+		delete(cd.buckets, key)
+	} else {
+		cd.buckets[key] = a
+	}
+	return a
+}
+
+// Fails with OnCooldown if bucket of invocation is exhausted, otherwise records invocation.
+func (cd *Cooldown) Check(ctx *Context) error {
+	key, err := cd.key(ctx)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	cd.mu.Lock()
+	defer cd.mu.Unlock()
+	if cd.buckets == nil {
+		cd.buckets = map[string][]time.Time{}
+	}
+	// sweep buckets from time to time, so they don't pile up
+	if cd.calls++; cd.calls%1024 == 0 {
+		for k := range cd.buckets {
+			cd.prune(k, now)
+		}
+	}
+	a := cd.prune(key, now)
+	if len(a) >= max(cd.Rate, 1) {
+		return OnCooldown{RetryAfter: cd.Per - now.Sub(a[0]), Bucket: cd.Bucket}
+	}
+	cd.buckets[key] = append(a, now)
+	return nil
+}
+
+// Resets all buckets.
+func (cd *Cooldown) Reset() {
+	cd.mu.Lock()
+	defer cd.mu.Unlock()
+	cd.buckets = nil
+}
+
+// Shortcut for NewCooldown(rate, per, bucket).Check.
+func CooldownCheck(rate int, per time.Duration, bucket BucketType) Check {
+	return NewCooldown(rate, per, bucket).Check
+}
@@ -0,0 +1,94 @@
+package commands
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/DarpHome/regolt"
+)
+
+const selfUser = `{"_id":"bot","username":"bot","relationship":"User","bot":{"owner":"owner"}}`
+
+func TestOwnerOnlyFetchesSelf(t *testing.T) {
+	hc := &testHTTPClient{routes: map[string]string{"/users/@me": selfUser}}
+	c := newTestCommands(t, hc)
+	check := OwnerOnly()
+	if err := check(testContext(c, "owner", "")); err != nil {
+		t.Fatalf("owner: %v", err)
+	}
+	if err := check(testContext(c, "bot", "")); err != nil {
+		t.Fatalf("bot itself: %v", err)
+	}
+	if err := check(testContext(c, "someone", "")); !errors.As(err, &NotOwner{}) {
+		t.Fatalf("someone: %v", err)
+	}
+	if n := hc.count("GET /users/@me"); n != 1 {
+		t.Fatalf("self fetched %d times", n)
+	}
+}
+
+func TestOwnerOnlyUsesSocketSelf(t *testing.T) {
+	hc := &testHTTPClient{routes: map[string]string{"/users/@me": selfUser}}
+	c := newTestCommands(t, hc)
+	// what socket sets on Ready
+	c.Socket.Me = &regolt.User{ID: "bot2", Bot: &regolt.UserBot{Owner: "owner2"}}
+	if err := OwnerOnly()(testContext(c, "owner2", "")); err != nil {
+		t.Fatalf("owner: %v", err)
+	}
+	if err := OwnerOnly()(testContext(c, "owner", "")); !errors.As(err, &NotOwner{}) {
+		t.Fatalf("owner of other bot: %v", err)
+	}
+	if n := hc.count("GET /users/@me"); n != 0 {
+		t.Fatalf("self fetched %d times", n)
+	}
+}
+
+func TestInstallSelfBot(t *testing.T) {
+	c := newTestCommands(t, &testHTTPClient{routes: map[string]string{"/users/@me": selfUser}})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		// reads race with InstallSelfBot unless Me is guarded
+		for i := 0; i < 100; i++ {
+			c.Socket.Self()
+		}
+	}()
+	if err := c.InstallSelfBot(); err != nil {
+		t.Fatal(err)
+	}
+	<-done
+	if me := c.Socket.Self(); me == nil || me.ID != "bot" {
+		t.Fatalf("self: %+v", me)
+	}
+	if !c.GlobalCheck(&testContext(c, "bot", "").LightContext) {
+		t.Fatal("self bot doesn't accept own messages")
+	}
+	if c.GlobalCheck(&testContext(c, "someone", "").LightContext) {
+		t.Fatal("self bot accepts messages of others")
+	}
+}
+
+func TestCheckErrorsGoToCommands(t *testing.T) {
+	c := newTestCommands(t, &testHTTPClient{routes: map[string]string{"/users/@me": selfUser}})
+	c.Register(&Command{
+		Name:     "secret",
+		Checks:   []Check{OwnerOnly()},
+		Callback: func(*Context) { t.Error("command invoked by someone") },
+	})
+	c.Socket.Events.Error.Listen(func(err error) {
+		t.Errorf("command error reached socket: %v", err)
+	})
+	var got []error
+	c.OnError(func(e *CommandError) {
+		if e.Context.Command == nil || e.Context.Command.Name != "secret" {
+			t.Errorf("context of error: %+v", e.Context)
+		}
+		got = append(got, e.Err)
+	})
+	ctx := testContext(c, "someone", "")
+	ctx.Label = "secret"
+	c.Handle(ctx)
+	if len(got) != 1 || !errors.As(got[0], &NotOwner{}) {
+		t.Fatalf("errors: %v", got)
+	}
+}
@@ -1,9 +1,10 @@
 package commands
 
 import (
-	"fmt"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/DarpHome/regolt"
 )
@@ -45,6 +46,19 @@ func (s *Scanner) GetByte() (byte, bool) {
 	return r, true
 }
 
+// Reads bytes until space or end of input.
+func (s *Scanner) Word() string {
+	r := []byte{}
+	for {
+		b, ok := s.GetByte()
+		if !ok || b == ' ' {
+			break
+		}
+		r = append(r, b)
+	}
+	return string(r)
+}
+
 func (s *Scanner) Transaction(f func(s *Scanner) bool) {
 	p := s.Position
 	if !f(s) {
@@ -55,6 +69,8 @@ func (s *Scanner) Transaction(f func(s *Scanner) bool) {
 type Context struct {
 	LightContext
 	Command *Command
+	// Commands from top-level one to Command, e.g. [mod, ban] for `!mod ban`
+	Path    []*Command
 	Prefix  string
 	Scanner *Scanner
 	Label   string
@@ -150,6 +166,83 @@ func (ctx *Context) String(name string, defaultValue ...string) string {
 	return ""
 }
 
+// Returns value of BoolOption.
+func (ctx *Context) Bool(name string, defaultValue ...bool) bool {
+	if v, ok := ctx.Options[name].(bool); ok {
+		return v
+	}
+	if len(defaultValue) != 0 {
+		return defaultValue[0]
+	}
+	return false
+}
+
+// Returns value of FloatOption.
+func (ctx *Context) Float(name string, defaultValue ...float64) float64 {
+	switch v := ctx.Options[name].(type) {
+	case float64:
+		return v
+	case float32:
+		return float64(v)
+	}
+	if len(defaultValue) != 0 {
+		return defaultValue[0]
+	}
+	return 0
+}
+
+// Returns value of DurationOption. Default value is used if option wasn't passed.
+func (ctx *Context) Duration(name string, defaultValue ...time.Duration) time.Duration {
+	if v, ok := ctx.Options[name].(time.Duration); ok && v != 0 {
+		return v
+	}
+	if len(defaultValue) != 0 {
+		return defaultValue[0]
+	}
+	return 0
+}
+
+// Returns value of TimeOption. Default value is used if option wasn't passed.
+func (ctx *Context) Time(name string, defaultValue ...time.Time) time.Time {
+	if v, ok := ctx.Options[name].(time.Time); ok && !v.IsZero() {
+		return v
+	}
+	if len(defaultValue) != 0 {
+		return defaultValue[0]
+	}
+	return time.Time{}
+}
+
+func option[T any](ctx *Context, name string) T {
+	v, _ := ctx.Options[name].(T)
+	return v
+}
+
+// Returns value of UserOption, nil if it wasn't passed.
+func (ctx *Context) User(name string) *regolt.OptimizedUser {
+	return option[*regolt.OptimizedUser](ctx, name)
+}
+
+// Returns value of MemberOption, nil if it wasn't passed.
+func (ctx *Context) Member(name string) *regolt.Member {
+	return option[*regolt.Member](ctx, name)
+}
+
+// Returns value of ChannelOption, nil if it wasn't passed.
+func (ctx *Context) Channel(name string) *regolt.OptimizedChannel {
+	return option[*regolt.OptimizedChannel](ctx, name)
+}
+
+// Returns value of RoleOption, nil if it wasn't passed.
+func (ctx *Context) Role(name string) *regolt.OptimizedRole {
+	return option[*regolt.OptimizedRole](ctx, name)
+}
+
+// Returns value of EmojiOption.
+func (ctx *Context) Emoji(name string) regolt.Emoji {
+	return option[regolt.Emoji](ctx, name)
+}
+
 type Handler interface {
 	HandleCommand(*Context)
 }
@@ -158,12 +251,23 @@ func (ctx *LightContext) Respond(sm *regolt.SendMessage) (*regolt.Message, error
 	return ctx.Manager.API.SendMessage(ctx.Message.Channel, sm)
 }
 
+// Uploads files and responds with them attached, see regolt.API.SendMessageWithFiles.
+func (ctx *LightContext) RespondWithFiles(sm *regolt.SendMessage, files ...*regolt.File) (*regolt.Message, error) {
+	return ctx.Manager.API.SendMessageWithFiles(ctx.Message.Channel, sm, files...)
+}
+
+// Reacts to message with emoji. s is either unicode emoji, custom emoji ID or `:name:` shortcode,
+// which is resolved against cached emojis of the server message was sent in.
 func (ctx *LightContext) ReactWith(s string) error {
-	e := regolt.Emoji{}
-	if strings.Contains(s[:1], "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZ") {
-		e.ID = regolt.ULID(s)
-	} else {
-		e.Emoji = s
+	e := regolt.ParseEmoji(s)
+	if !e.IsCustom() && strings.HasPrefix(e.Emoji, ":") && ctx.Manager.Socket != nil && ctx.Manager.Socket.Cache != nil {
+		if c := ctx.Manager.Socket.Cache.Channels.Get(ctx.Message.Channel); c != nil && len(c.Server) != 0 {
+			r, err := ctx.Manager.Socket.Cache.ResolveEmoji(c.Server, s)
+			if err != nil {
+				return err
+			}
+			e = r
+		}
 	}
 	return ctx.Manager.API.AddReactionToMessage(ctx.Message.Channel, ctx.Message.ID, e)
 }
@@ -176,8 +280,15 @@ type Command struct {
 	Name        string
 	Aliases     []string
 	Description string
-	Options     []Option
-	Callback    CommandCallback
+	// Longer description shown by HelpText
+	Help    string
+	Options []Option
+	// Checks run before options are parsed, checks of group apply to its subcommands as well
+	Checks []Check
+	// Called if no subcommand matched, nil to report UnknownSubcommand instead
+	Callback CommandCallback
+	// Commands invoked as `group subcommand`. Call Commands.Refresh after changing them at runtime.
+	Subcommands []*Command
 }
 
 type Commands struct {
@@ -189,6 +300,34 @@ type Commands struct {
 	Commands    []*Command
 	API         *regolt.API
 	Socket      *regolt.Socket
+	// Used to resolve entities, created from API and Socket.Cache if nil
+	Client     *regolt.Client
+	clientOnce sync.Once
+	// current user fetched via API while socket hasn't received Ready
+	selfMu sync.Mutex
+	self   *regolt.User
+	mu     sync.RWMutex
+	// lookup table, built from Commands
+	tree map[string]*commandNode
+	// Failed checks, option parse errors and unknown subcommands. They aren't emitted through
+	// Socket.Events.Error, as socket treats errors there as connection failures.
+	Errors *regolt.EventController[*CommandError]
+}
+
+// Error which occurred while handling command.
+type CommandError struct {
+	Context *Context
+	Err     error
+}
+
+func (c *Commands) OnError(f func(*CommandError)) *regolt.Subscription[*CommandError] {
+	return c.Errors.Listen(f)
+}
+
+func (c *Commands) emitError(ctx *Context, err error) {
+	if c.Errors != nil {
+		c.Errors.Emit(&CommandError{Context: ctx, Err: err})
+	}
 }
 
 func (c *Commands) Install() *Commands {
@@ -265,11 +404,13 @@ func (g Greedy) Parse(ctx *Context) (any, error) {
 	a := []any{}
 	for {
 		if !ctx.Scanner.CanNext() {
-			fmt.Println("??")
 			break
 		}
+		// value which failed to parse is left for the next option
+		p := ctx.Scanner.Position
 		b, err := g.Option.Parse(ctx)
 		if err != nil {
+			ctx.Scanner.Position = p
 			break
 		}
 		a = append(a, b)
@@ -382,6 +523,32 @@ func (so StringOption) Parse(ctx *Context) (any, error) {
 	return string(r), nil
 }
 
+// Parses raw ULID.
+type ULIDOption struct {
+	Name        string
+	Description string
+	Required    bool
+}
+
+func (o ULIDOption) GetName() string {
+	return o.Name
+}
+
+func (o ULIDOption) GetDescription() string {
+	return o.Description
+}
+
+func (uo ULIDOption) Parse(ctx *Context) (any, error) {
+	w := ctx.Scanner.Word()
+	if len(w) == 0 {
+		if uo.Required {
+			return regolt.ULID(""), OptionRequired{Name: uo.Name}
+		}
+		return regolt.ULID(""), nil
+	}
+	return regolt.ParseULID(w)
+}
+
 func (c *Commands) handle(m *regolt.Message) {
 	if c.Prefix == nil {
 		return
@@ -421,29 +588,45 @@ func (c *Commands) handle(m *regolt.Message) {
 }
 
 func (c *Commands) Handle(ctx *Context) {
-	var co *Command
-	for _, d := range c.Commands {
-		if d.Name == ctx.Label {
-			co = d
+	n := c.lookup(ctx.Label)
+	if n == nil {
+		return
+	}
+	for {
+		ctx.Command = n.command
+		ctx.Path = append(ctx.Path, n.command)
+		for _, check := range n.command.Checks {
+			if err := check(ctx); err != nil {
+				c.emitError(ctx, err)
+				return
+			}
+		}
+		if len(n.children) == 0 {
 			break
 		}
-		for _, a := range d.Aliases {
-			if a == ctx.Label {
-				co = d
-				break
-			}
+		p := ctx.Scanner.Position
+		name := ctx.Scanner.Word()
+		if next, ok := n.children[name]; ok {
+			n = next
+			continue
 		}
+		ctx.Scanner.Position = p
+		if n.command.Callback == nil {
+			c.emitError(ctx, UnknownSubcommand{Command: n.command.Name, Name: name})
+			return
+		}
+		break
 	}
-	if co == nil {
-		return
-	}
-	ctx.Command = co
+	co := ctx.Command
 	for i := 0; i < len(co.Options); i++ {
 		o := co.Options[i]
 		name := o.GetName()
 		r, err := o.Parse(ctx)
 		if err != nil {
-			c.Socket.Events.Error.Emit(err)
+			if _, ok := err.(OptionRequired); !ok {
+				err = InvalidOption{Name: name, Err: err}
+			}
+			c.emitError(ctx, err)
 			return
 		}
 		ctx.Options[name] = r
@@ -453,7 +636,8 @@ func (c *Commands) Handle(ctx *Context) {
 
 func selfBot() GlobalCheck {
 	return func(ctx *LightContext) bool {
-		return ctx.Manager.Socket.Me.ID == ctx.Message.Author
+		me := ctx.Manager.Socket.Self()
+		return me != nil && me.ID == ctx.Message.Author
 	}
 }
 
@@ -462,7 +646,7 @@ func (c *Commands) InstallSelfBot() error {
 	if err != nil {
 		return err
 	}
-	c.Socket.Me = u
+	c.Socket.SetSelf(u)
 	c.GlobalCheck = selfBot()
 	return nil
 }
@@ -495,10 +679,12 @@ func New(api *regolt.API, socket *regolt.Socket, config Config) *Commands {
 	c := &Commands{
 		API:      api,
 		Socket:   socket,
+		Client:   regolt.NewClient(api, socket.Cache),
 		Commands: config.Commands,
 		Config:   config,
 		Handler:  config.Handler,
 		Prefix:   p,
+		Errors:   regolt.NewEventController[*CommandError](),
 	}
 	return c
 }
@@ -0,0 +1,69 @@
+package commands
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/DarpHome/regolt"
+)
+
+// Serves GET requests from routes, keyed by path, and responds 404 to everything else.
+type testHTTPClient struct {
+	mu       sync.Mutex
+	routes   map[string]string
+	requests []string
+}
+
+func (c *testHTTPClient) Perform(r *http.Request) (*http.Response, error) {
+	c.mu.Lock()
+	c.requests = append(c.requests, r.Method+" "+r.URL.Path)
+	body, ok := c.routes[r.URL.Path]
+	c.mu.Unlock()
+	status := 200
+	if !ok || r.Method != "GET" {
+		status, body = 404, `{"type":"NotFound"}`
+	}
+	return &http.Response{
+		StatusCode: status,
+		Header:     http.Header{"Content-Type": {"application/json"}},
+		Body:       io.NopCloser(strings.NewReader(body)),
+		Request:    r,
+	}, nil
+}
+
+func (c *testHTTPClient) count(request string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	n := 0
+	for _, r := range c.requests {
+		if r == request {
+			n++
+		}
+	}
+	return n
+}
+
+// Returns commands with default (disabled) cache, which resolve everything via hc.
+func newTestCommands(t *testing.T, hc regolt.HTTPClient) *Commands {
+	t.Helper()
+	api, err := regolt.NewAPI(nil, &regolt.APIConfig{HTTPClient: hc, DisableRateLimiter: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	socket, err := regolt.NewSocket("", &regolt.SocketConfig{DisableLogging: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return New(api, socket, Config{Prefix: "!"})
+}
+
+func testContext(c *Commands, author regolt.ULID, content string) *Context {
+	return &Context{
+		LightContext: LightContext{Manager: c, Message: &regolt.Message{Author: author, Channel: "c1", Content: content}},
+		Scanner:      &Scanner{Manager: c, Target: content},
+		Options:      map[string]any{},
+	}
+}
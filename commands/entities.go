@@ -0,0 +1,319 @@
+package commands
+
+import (
+	"strings"
+
+	"github.com/DarpHome/regolt"
+)
+
+// Returns client used to resolve entities, entities are taken from socket cache and fetched if missing.
+func (c *Commands) client() *regolt.Client {
+	c.clientOnce.Do(func() {
+		if c.Client == nil {
+			c.Client = regolt.NewClient(c.API, c.Socket.Cache)
+		}
+	})
+	return c.Client
+}
+
+// Returns current user. Until socket receives Ready, it is fetched once via API.
+func (c *Commands) me() (*regolt.User, error) {
+	if u := c.Socket.Self(); u != nil {
+		return u, nil
+	}
+	c.selfMu.Lock()
+	u := c.self
+	c.selfMu.Unlock()
+	if u != nil {
+		return u, nil
+	}
+	u, err := c.API.FetchSelf()
+	if err != nil {
+		return nil, err
+	}
+	c.selfMu.Lock()
+	c.self = u
+	c.selfMu.Unlock()
+	return u, nil
+}
+
+// Returns channel message was sent in.
+func (ctx *LightContext) CurrentChannel() (*regolt.OptimizedChannel, error) {
+	return ctx.Manager.client().GetOrFetchChannel(ctx.Message.Channel)
+}
+
+// Returns ID of server message was sent in, empty if message was sent outside of server.
+func (ctx *LightContext) CurrentServer() (regolt.ULID, error) {
+	c, err := ctx.CurrentChannel()
+	if err != nil {
+		return "", err
+	}
+	return c.Server, nil
+}
+
+// Parses `<{sigil}ULID>` mention or raw ULID.
+func parseMention(s string, sigil byte) (regolt.ULID, bool) {
+	if len(s) > 3 && s[0] == '<' && s[1] == sigil && s[len(s)-1] == '>' {
+		s = s[2 : len(s)-1]
+	}
+	id, err := regolt.ParseULID(s)
+	return id, err == nil
+}
+
+// Finds user by `username` or `username#discriminator` in cache, then among server members.
+func (ctx *LightContext) findUserByName(server regolt.ULID, query string) (*regolt.OptimizedUser, error) {
+	name, discriminator, _ := strings.Cut(query, "#")
+	match := func(username, d string) bool {
+		return strings.EqualFold(username, name) && (len(discriminator) == 0 || d == discriminator)
+	}
+	c := ctx.Manager.client()
+	var found *regolt.OptimizedUser
+	c.Cache.Users.Range(func(u *regolt.OptimizedUser) bool {
+		if match(u.Username, u.Discriminator) {
+			found = u
+			return false
+		}
+		return true
+	})
+	if found != nil || len(server) == 0 {
+		return found, nil
+	}
+	members, users, err := c.API.QueryMembersByName(server, name)
+	if err != nil {
+		return nil, err
+	}
+	for _, m := range members {
+		c.Cache.Members.Set(server, m)
+	}
+	for _, u := range users {
+		o := u.ToOptimized()
+		c.Cache.Users.Set(o)
+		if found == nil && match(u.Username, u.Discriminator) {
+			found = o
+		}
+	}
+	if found == nil && len(discriminator) == 0 {
+		for _, m := range members {
+			if strings.EqualFold(m.Nickname, name) {
+				return c.GetOrFetchUser(m.ID.User)
+			}
+		}
+	}
+	return found, nil
+}
+
+func (ctx *LightContext) resolveUser(w string) (*regolt.OptimizedUser, error) {
+	if id, ok := parseMention(w, '@'); ok {
+		return ctx.Manager.client().GetOrFetchUser(id)
+	}
+	server, err := ctx.CurrentServer()
+	if err != nil {
+		return nil, err
+	}
+	u, err := ctx.findUserByName(server, strings.TrimPrefix(w, "@"))
+	if err != nil {
+		return nil, err
+	}
+	if u == nil {
+		return nil, EntityNotFound{Kind: "user", Query: w}
+	}
+	return u, nil
+}
+
+// Resolves user mention (`<@ULID>`), ID or username (optionally with `#discriminator`).
+// Usernames are looked up in cache first, then among members of the server.
+type UserOption struct {
+	Name        string
+	Description string
+	Required    bool
+}
+
+func (o UserOption) GetName() string {
+	return o.Name
+}
+
+func (o UserOption) GetDescription() string {
+	return o.Description
+}
+
+func (uo UserOption) Parse(ctx *Context) (any, error) {
+	w := ctx.Scanner.Word()
+	if len(w) == 0 {
+		if uo.Required {
+			return (*regolt.OptimizedUser)(nil), OptionRequired{Name: uo.Name}
+		}
+		return (*regolt.OptimizedUser)(nil), nil
+	}
+	return ctx.resolveUser(w)
+}
+
+// Same as UserOption, but resolves member of the server message was sent in.
+type MemberOption struct {
+	Name        string
+	Description string
+	Required    bool
+}
+
+func (o MemberOption) GetName() string {
+	return o.Name
+}
+
+func (o MemberOption) GetDescription() string {
+	return o.Description
+}
+
+func (mo MemberOption) Parse(ctx *Context) (any, error) {
+	w := ctx.Scanner.Word()
+	if len(w) == 0 {
+		if mo.Required {
+			return (*regolt.Member)(nil), OptionRequired{Name: mo.Name}
+		}
+		return (*regolt.Member)(nil), nil
+	}
+	server, err := ctx.CurrentServer()
+	if err != nil {
+		return nil, err
+	}
+	if len(server) == 0 {
+		return nil, NotInServer{}
+	}
+	u, err := ctx.resolveUser(w)
+	if err != nil {
+		return nil, err
+	}
+	return ctx.Manager.client().GetOrFetchMember(server, u.ID)
+}
+
+// Resolves channel mention (`<#ULID>`), ID or name of channel in the current server.
+type ChannelOption struct {
+	Name        string
+	Description string
+	Required    bool
+}
+
+func (o ChannelOption) GetName() string {
+	return o.Name
+}
+
+func (o ChannelOption) GetDescription() string {
+	return o.Description
+}
+
+func (co ChannelOption) Parse(ctx *Context) (any, error) {
+	w := ctx.Scanner.Word()
+	if len(w) == 0 {
+		if co.Required {
+			return (*regolt.OptimizedChannel)(nil), OptionRequired{Name: co.Name}
+		}
+		return (*regolt.OptimizedChannel)(nil), nil
+	}
+	c := ctx.Manager.client()
+	if id, ok := parseMention(w, '#'); ok {
+		return c.GetOrFetchChannel(id)
+	}
+	server, err := ctx.CurrentServer()
+	if err != nil {
+		return nil, err
+	}
+	if len(server) != 0 {
+		s, err := c.GetOrFetchServer(server)
+		if err != nil {
+			return nil, err
+		}
+		name := strings.TrimPrefix(w, "#")
+		for _, id := range s.Channels {
+			ch, err := c.GetOrFetchChannel(id)
+			if err != nil {
+				return nil, err
+			}
+			if strings.EqualFold(ch.Name, name) {
+				return ch, nil
+			}
+		}
+	}
+	return nil, EntityNotFound{Kind: "channel", Query: w}
+}
+
+// Resolves role mention (`<%ULID>`), ID or name of role in the current server.
+type RoleOption struct {
+	Name        string
+	Description string
+	Required    bool
+}
+
+func (o RoleOption) GetName() string {
+	return o.Name
+}
+
+func (o RoleOption) GetDescription() string {
+	return o.Description
+}
+
+func (ro RoleOption) Parse(ctx *Context) (any, error) {
+	w := ctx.Scanner.Word()
+	if len(w) == 0 {
+		if ro.Required {
+			return (*regolt.OptimizedRole)(nil), OptionRequired{Name: ro.Name}
+		}
+		return (*regolt.OptimizedRole)(nil), nil
+	}
+	server, err := ctx.CurrentServer()
+	if err != nil {
+		return nil, err
+	}
+	if len(server) == 0 {
+		return nil, NotInServer{}
+	}
+	roles, err := ctx.Manager.client().GetOrFetchRoles(server)
+	if err != nil {
+		return nil, err
+	}
+	if id, ok := parseMention(w, '%'); ok {
+		if r, ok := roles[id]; ok {
+			return r, nil
+		}
+	}
+	for _, r := range roles {
+		if strings.EqualFold(r.Name, w) {
+			return r, nil
+		}
+	}
+	return nil, EntityNotFound{Kind: "role", Query: w}
+}
+
+// Resolves unicode emoji, custom emoji ID, `:ULID:` or `:name:` of emoji in the current server.
+type EmojiOption struct {
+	Name        string
+	Description string
+	Required    bool
+}
+
+func (o EmojiOption) GetName() string {
+	return o.Name
+}
+
+func (o EmojiOption) GetDescription() string {
+	return o.Description
+}
+
+func (eo EmojiOption) Parse(ctx *Context) (any, error) {
+	w := ctx.Scanner.Word()
+	if len(w) == 0 {
+		if eo.Required {
+			return regolt.Emoji{}, OptionRequired{Name: eo.Name}
+		}
+		return regolt.Emoji{}, nil
+	}
+	e := regolt.ParseEmoji(w)
+	if e.IsCustom() || !strings.HasPrefix(w, ":") {
+		return e, nil
+	}
+	server, err := ctx.CurrentServer()
+	if err != nil {
+		return nil, err
+	}
+	if len(server) == 0 {
+		return nil, EntityNotFound{Kind: "emoji", Query: w}
+	}
+	return ctx.Manager.client().ResolveEmoji(server, w)
+}
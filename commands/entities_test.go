@@ -0,0 +1,95 @@
+package commands
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/DarpHome/regolt"
+)
+
+const (
+	testChannel2 = "01HGJ1MBSC2JBQ0M0ZJ8R3M1C2"
+	testRole1    = "01HGJ1MBSC2JBQ0M0ZJ8R3M1R1"
+	testRole2    = "01HGJ1MBSC2JBQ0M0ZJ8R3M1R2"
+)
+
+// Server s1 with channels c1 (general, where messages are sent) and testChannel2 (random),
+// and roles testRole1 (mod) and testRole2 (member).
+func newEntitiesHTTPClient() *testHTTPClient {
+	return &testHTTPClient{routes: map[string]string{
+		"/channels/c1":              `{"channel_type":"TextChannel","_id":"c1","server":"s1","name":"general"}`,
+		"/channels/" + testChannel2: `{"channel_type":"TextChannel","_id":"` + testChannel2 + `","server":"s1","name":"random"}`,
+		"/servers/s1": `{"_id":"s1","owner":"u1","name":"server","channels":["c1","` + testChannel2 + `"],
+			"roles":{"` + testRole1 + `":{"name":"mod","permissions":{"a":0,"d":0},"rank":1},
+			"` + testRole2 + `":{"name":"member","permissions":{"a":0,"d":0},"rank":2}},"default_permissions":0}`,
+	}}
+}
+
+func TestRoleOptionDefaultCache(t *testing.T) {
+	c := newTestCommands(t, newEntitiesHTTPClient())
+	tests := []struct {
+		input string
+		want  regolt.ULID
+	}{
+		{"mod", testRole1},
+		{"MEMBER", testRole2},
+		{testRole2, testRole2},
+		{"<%" + testRole1 + ">", testRole1},
+	}
+	for _, tt := range tests {
+		r, err := RoleOption{Name: "role"}.Parse(testContext(c, "u1", tt.input))
+		if err != nil {
+			t.Fatalf("%s: %v", tt.input, err)
+		}
+		if id := r.(*regolt.OptimizedRole).ID; id != tt.want {
+			t.Fatalf("%s: got role %s, want %s", tt.input, id, tt.want)
+		}
+	}
+	_, err := RoleOption{Name: "role"}.Parse(testContext(c, "u1", "admin"))
+	if !errors.As(err, &EntityNotFound{}) {
+		t.Fatalf("unknown role: %v", err)
+	}
+}
+
+func TestChannelOptionDefaultCache(t *testing.T) {
+	c := newTestCommands(t, newEntitiesHTTPClient())
+	tests := []struct {
+		input string
+		want  regolt.ULID
+	}{
+		{"general", "c1"},
+		{"#random", testChannel2},
+		{"RANDOM", testChannel2},
+		{testChannel2, testChannel2},
+		{"<#" + testChannel2 + ">", testChannel2},
+	}
+	for _, tt := range tests {
+		ch, err := ChannelOption{Name: "channel"}.Parse(testContext(c, "u1", tt.input))
+		if err != nil {
+			t.Fatalf("%s: %v", tt.input, err)
+		}
+		if id := ch.(*regolt.OptimizedChannel).ID; id != tt.want {
+			t.Fatalf("%s: got channel %s, want %s", tt.input, id, tt.want)
+		}
+	}
+	_, err := ChannelOption{Name: "channel"}.Parse(testContext(c, "u1", "memes"))
+	if !errors.As(err, &EntityNotFound{}) {
+		t.Fatalf("unknown channel: %v", err)
+	}
+}
+
+func TestRoleOptionUsesCachedRoles(t *testing.T) {
+	hc := newEntitiesHTTPClient()
+	c := newTestCommands(t, hc)
+	c.Socket.Cache.Channels.MaxSize = -1
+	c.Socket.Cache.Servers.MaxSize = -1
+	c.Socket.Cache.Roles.TotalMaxSize = 100
+	for i := 0; i < 3; i++ {
+		if _, err := (RoleOption{Name: "role"}).Parse(testContext(c, "u1", "mod")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := hc.count("GET /servers/s1"); n != 1 {
+		t.Fatalf("server fetched %d times", n)
+	}
+}
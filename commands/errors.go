@@ -1,5 +1,13 @@
 package commands
 
+import (
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/DarpHome/regolt"
+)
+
 type OptionRequired struct {
 	Name string
 }
@@ -15,3 +23,167 @@ type DisallowedEscape struct {
 func (de DisallowedEscape) Error() string {
 	return "tried use " + de.Which + " escape, but it is disallowed!"
 }
+
+// Returned when option value can't be parsed.
+type InvalidOption struct {
+	Name string
+	Err  error
+}
+
+func (io InvalidOption) Error() string {
+	return "invalid value of option " + io.Name + ": " + io.Err.Error()
+}
+
+func (io InvalidOption) Unwrap() error {
+	return io.Err
+}
+
+// Returned by Bind when field type has no corresponding option.
+type UnsupportedOptionType struct {
+	Field string
+	Type  reflect.Type
+}
+
+func (uot UnsupportedOptionType) Error() string {
+	return "field " + uot.Field + " has unsupported option type " + uot.Type.String()
+}
+
+// Returned when parsed option value can't be assigned to field.
+type OptionTypeMismatch struct {
+	Name string
+	Want reflect.Type
+	Got  reflect.Type
+}
+
+func (otm OptionTypeMismatch) Error() string {
+	got := "nil"
+	if otm.Got != nil {
+		got = otm.Got.String()
+	}
+	return "option " + otm.Name + " has type " + got + ", but field is " + otm.Want.String()
+}
+
+type EntityNotFound struct {
+	Kind  string
+	Query string
+}
+
+func (enf EntityNotFound) Error() string {
+	return enf.Kind + " not found: " + enf.Query
+}
+
+// Returned when option requires server, but command was used outside of one.
+type NotInServer struct{}
+
+func (NotInServer) Error() string {
+	return "command can be used only in servers"
+}
+
+type InvalidBool struct {
+	Value string
+}
+
+func (ib InvalidBool) Error() string {
+	return "expected yes or no, got " + ib.Value
+}
+
+type InvalidDuration struct {
+	Value string
+}
+
+func (id InvalidDuration) Error() string {
+	return "invalid duration: " + id.Value
+}
+
+type DurationOutOfRange struct {
+	Value time.Duration
+	// Zero if there is no limit
+	Min, Max time.Duration
+}
+
+func (dor DurationOutOfRange) Error() string {
+	switch {
+	case dor.Min != 0 && dor.Value < dor.Min:
+		return "duration " + dor.Value.String() + " is shorter than " + dor.Min.String()
+	default:
+		return "duration " + dor.Value.String() + " is longer than " + dor.Max.String()
+	}
+}
+
+type InvalidChoice struct {
+	Value   string
+	Choices []string
+}
+
+func (ic InvalidChoice) Error() string {
+	return "invalid choice " + ic.Value + ", expected one of: " + strings.Join(ic.Choices, ", ")
+}
+
+type InvalidTime struct {
+	Value string
+}
+
+func (it InvalidTime) Error() string {
+	return "invalid time: " + it.Value
+}
+
+type PatternMismatch struct {
+	Value   string
+	Pattern string
+}
+
+func (pm PatternMismatch) Error() string {
+	return pm.Value + " doesn't match " + pm.Pattern
+}
+
+// Returned when group without callback is invoked with unknown or without subcommand.
+type UnknownSubcommand struct {
+	Command string
+	// Empty if subcommand wasn't specified
+	Name string
+}
+
+func (us UnknownSubcommand) Error() string {
+	if len(us.Name) == 0 {
+		return "subcommand of " + us.Command + " required"
+	}
+	return "unknown subcommand of " + us.Command + ": " + us.Name
+}
+
+// Returned when command can be used only in direct messages and groups.
+type NotInPrivateChannel struct{}
+
+func (NotInPrivateChannel) Error() string {
+	return "command can be used only in direct messages and groups"
+}
+
+type NotOwner struct{}
+
+func (NotOwner) Error() string {
+	return "command can be used only by owner"
+}
+
+type MissingPermissions struct {
+	Missing regolt.Permissions
+}
+
+func (mp MissingPermissions) Error() string {
+	return "missing permissions: " + mp.Missing.String()
+}
+
+type BotMissingPermissions struct {
+	Missing regolt.Permissions
+}
+
+func (bmp BotMissingPermissions) Error() string {
+	return "bot is missing permissions: " + bmp.Missing.String()
+}
+
+type OnCooldown struct {
+	RetryAfter time.Duration
+	Bucket     BucketType
+}
+
+func (oc OnCooldown) Error() string {
+	return "command is on cooldown, retry after " + oc.RetryAfter.String()
+}
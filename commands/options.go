@@ -0,0 +1,278 @@
+package commands
+
+import (
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	trueValues  = []string{"yes", "y", "on", "true", "t", "1", "enable", "enabled"}
+	falseValues = []string{"no", "n", "off", "false", "f", "0", "disable", "disabled"}
+)
+
+// Parses yes/no, on/off, true/false, 1/0 and enable/disable, case insensitive.
+type BoolOption struct {
+	Name        string
+	Description string
+	Required    bool
+}
+
+func (o BoolOption) GetName() string {
+	return o.Name
+}
+
+func (o BoolOption) GetDescription() string {
+	return o.Description
+}
+
+func (bo BoolOption) Parse(ctx *Context) (any, error) {
+	w := strings.ToLower(ctx.Scanner.Word())
+	if len(w) == 0 {
+		if bo.Required {
+			return false, OptionRequired{Name: bo.Name}
+		}
+		return false, nil
+	}
+	for _, v := range trueValues {
+		if w == v {
+			return true, nil
+		}
+	}
+	for _, v := range falseValues {
+		if w == v {
+			return false, nil
+		}
+	}
+	return false, InvalidBool{Value: w}
+}
+
+type FloatOption struct {
+	Name        string
+	Description string
+	BitSize     int
+	Required    bool
+}
+
+func (o FloatOption) GetName() string {
+	return o.Name
+}
+
+func (o FloatOption) GetDescription() string {
+	return o.Description
+}
+
+func (fo FloatOption) Parse(ctx *Context) (any, error) {
+	w := ctx.Scanner.Word()
+	if len(w) == 0 {
+		if fo.Required {
+			return float64(0), OptionRequired{Name: fo.Name}
+		}
+		return float64(0), nil
+	}
+	bitSize := fo.BitSize
+	if bitSize == 0 {
+		bitSize = 64
+	}
+	return strconv.ParseFloat(w, bitSize)
+}
+
+var durationUnits = map[string]time.Duration{
+	"ms": time.Millisecond,
+	"s":  time.Second,
+	"m":  time.Minute,
+	"h":  time.Hour,
+	"d":  24 * time.Hour,
+	"w":  7 * 24 * time.Hour,
+}
+
+// Parses durations like `1h30m`, `7d` or `1.5h`. Units are ms, s, m, h, d and w.
+func ParseDuration(s string) (time.Duration, error) {
+	if len(s) == 0 {
+		return 0, InvalidDuration{Value: s}
+	}
+	var d time.Duration
+	for i := 0; i < len(s); {
+		j := i
+		for j < len(s) && (s[j] >= '0' && s[j] <= '9' || s[j] == '.') {
+			j++
+		}
+		k := j
+		for k < len(s) && (s[k] >= 'a' && s[k] <= 'z' || s[k] >= 'A' && s[k] <= 'Z') {
+			k++
+		}
+		n, err := strconv.ParseFloat(s[i:j], 64)
+		unit, ok := durationUnits[strings.ToLower(s[j:k])]
+		if err != nil || !ok {
+			return 0, InvalidDuration{Value: s}
+		}
+		// converting float which doesn't fit into int64 is implementation-defined, so check before it
+		f := n * float64(unit)
+		if math.IsNaN(f) || math.IsInf(f, 0) || f < 0 || f >= math.MaxInt64 {
+			return 0, InvalidDuration{Value: s}
+		}
+		v := time.Duration(f)
+		if d > math.MaxInt64-v {
+			return 0, InvalidDuration{Value: s}
+		}
+		d += v
+		i = k
+	}
+	return d, nil
+}
+
+// Parses duration in format of ParseDuration. Zero Min and Max mean no limit.
+type DurationOption struct {
+	Name        string
+	Description string
+	Min         time.Duration
+	Max         time.Duration
+	Required    bool
+}
+
+func (o DurationOption) GetName() string {
+	return o.Name
+}
+
+func (o DurationOption) GetDescription() string {
+	return o.Description
+}
+
+func (do DurationOption) Parse(ctx *Context) (any, error) {
+	w := ctx.Scanner.Word()
+	if len(w) == 0 {
+		if do.Required {
+			return time.Duration(0), OptionRequired{Name: do.Name}
+		}
+		return time.Duration(0), nil
+	}
+	d, err := ParseDuration(w)
+	if err != nil {
+		return time.Duration(0), err
+	}
+	if (do.Min != 0 && d < do.Min) || (do.Max != 0 && d > do.Max) {
+		return time.Duration(0), DurationOutOfRange{Value: d, Min: do.Min, Max: do.Max}
+	}
+	return d, nil
+}
+
+// Accepts one of Choices, value is returned as it is written in Choices.
+type ChoiceOption struct {
+	Name          string
+	Description   string
+	Choices       []string
+	CaseSensitive bool
+	Required      bool
+}
+
+func (o ChoiceOption) GetName() string {
+	return o.Name
+}
+
+func (o ChoiceOption) GetDescription() string {
+	return o.Description
+}
+
+func (co ChoiceOption) Parse(ctx *Context) (any, error) {
+	w := ctx.Scanner.Word()
+	if len(w) == 0 {
+		if co.Required {
+			return "", OptionRequired{Name: co.Name}
+		}
+		return "", nil
+	}
+	for _, c := range co.Choices {
+		if c == w || (!co.CaseSensitive && strings.EqualFold(c, w)) {
+			return c, nil
+		}
+	}
+	return "", InvalidChoice{Value: w, Choices: co.Choices}
+}
+
+var defaultTimeLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04",
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02",
+}
+
+// Parses absolute time. Unix timestamps are accepted as well.
+type TimeOption struct {
+	Name        string
+	Description string
+	// Defaults to RFC 3339 and `2006-01-02`, optionally followed by time (`15:04` or `15:04:05`).
+	// Quote the value if layout contains spaces.
+	Layouts []string
+	// Used when layout has no time zone, defaults to UTC
+	Location *time.Location
+	Required bool
+}
+
+func (o TimeOption) GetName() string {
+	return o.Name
+}
+
+func (o TimeOption) GetDescription() string {
+	return o.Description
+}
+
+func (to TimeOption) Parse(ctx *Context) (any, error) {
+	r, err := StringOption{Name: to.Name, Required: to.Required}.Parse(ctx)
+	if err != nil {
+		return time.Time{}, err
+	}
+	s := r.(string)
+	if len(s) == 0 {
+		return time.Time{}, nil
+	}
+	if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return time.Unix(n, 0), nil
+	}
+	layouts := to.Layouts
+	if len(layouts) == 0 {
+		layouts = defaultTimeLayouts
+	}
+	loc := to.Location
+	if loc == nil {
+		loc = time.UTC
+	}
+	for _, l := range layouts {
+		if t, err := time.ParseInLocation(l, s, loc); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, InvalidTime{Value: s}
+}
+
+// Accepts word matching Pattern. Use anchors (`^...$`) to match whole word.
+type RegexOption struct {
+	Name        string
+	Description string
+	Pattern     *regexp.Regexp
+	Required    bool
+}
+
+func (o RegexOption) GetName() string {
+	return o.Name
+}
+
+func (o RegexOption) GetDescription() string {
+	return o.Description
+}
+
+func (ro RegexOption) Parse(ctx *Context) (any, error) {
+	w := ctx.Scanner.Word()
+	if len(w) == 0 {
+		if ro.Required {
+			return "", OptionRequired{Name: ro.Name}
+		}
+		return "", nil
+	}
+	if !ro.Pattern.MatchString(w) {
+		return "", PatternMismatch{Value: w, Pattern: ro.Pattern.String()}
+	}
+	return w, nil
+}
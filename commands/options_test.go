@@ -0,0 +1,44 @@
+package commands
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestParseDuration(t *testing.T) {
+	tests := []struct {
+		s    string
+		want time.Duration
+		ok   bool
+	}{
+		{"1h30m", 90 * time.Minute, true},
+		{"7d", 7 * 24 * time.Hour, true},
+		{"1.5h", 90 * time.Minute, true},
+		{"2w3d", 17 * 24 * time.Hour, true},
+		{"250ms", 250 * time.Millisecond, true},
+		{"10S", 10 * time.Second, true},
+		{"", 0, false},
+		{"10", 0, false},
+		{"h", 0, false},
+		{"10y", 0, false},
+		{"1..5h", 0, false},
+		// overflow
+		{"1e300w", 0, false},
+		{"15251w", 0, false},
+		{"15000w15000w", 0, false},
+		{"9223372036854775807ms", 0, false},
+	}
+	for _, tt := range tests {
+		d, err := ParseDuration(tt.s)
+		if tt.ok {
+			if err != nil || d != tt.want {
+				t.Errorf("ParseDuration(%q) = %v, %v, want %v", tt.s, d, err, tt.want)
+			}
+			continue
+		}
+		if !errors.As(err, &InvalidDuration{}) {
+			t.Errorf("ParseDuration(%q) = %v, %v, want InvalidDuration", tt.s, d, err)
+		}
+	}
+}
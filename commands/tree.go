@@ -0,0 +1,149 @@
+package commands
+
+import (
+	"slices"
+	"strings"
+)
+
+// Runs before command is invoked, returned error is emitted through Commands.Errors and the command isn't invoked.
+type Check func(ctx *Context) error
+
+type commandNode struct {
+	command  *Command
+	children map[string]*commandNode
+}
+
+func buildTree(commands []*Command) map[string]*commandNode {
+	m := make(map[string]*commandNode, len(commands))
+	for _, co := range commands {
+		n := &commandNode{command: co}
+		if len(co.Subcommands) != 0 {
+			n.children = buildTree(co.Subcommands)
+		}
+		m[co.Name] = n
+		for _, a := range co.Aliases {
+			// names take precedence over aliases
+			if _, ok := m[a]; !ok {
+				m[a] = n
+			}
+		}
+	}
+	return m
+}
+
+func (c *Commands) lookup(name string) *commandNode {
+	c.mu.RLock()
+	tree := c.tree
+	c.mu.RUnlock()
+	if tree == nil {
+		c.Refresh()
+		c.mu.RLock()
+		tree = c.tree
+		c.mu.RUnlock()
+	}
+	return tree[name]
+}
+
+// Rebuilds lookup table, must be called after Commands or Subcommands are modified directly.
+func (c *Commands) Refresh() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.tree = buildTree(c.Commands)
+}
+
+// Adds commands at runtime. Commands with the same name are replaced.
+func (c *Commands) Register(commands ...*Command) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, co := range commands {
+		c.Commands = slices.DeleteFunc(c.Commands, func(d *Command) bool {
+			return d.Name == co.Name
+		})
+		c.Commands = append(c.Commands, co)
+	}
+	c.tree = buildTree(c.Commands)
+}
+
+// Removes top-level commands by name at runtime.
+func (c *Commands) Unregister(names ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.Commands = slices.DeleteFunc(c.Commands, func(d *Command) bool {
+		return slices.Contains(names, d.Name)
+	})
+	c.tree = buildTree(c.Commands)
+}
+
+// Finds command by path, e.g. `Find("mod", "ban")`. Aliases are accepted.
+func (c *Commands) Find(path ...string) *Command {
+	if len(path) == 0 {
+		return nil
+	}
+	n := c.lookup(path[0])
+	for _, name := range path[1:] {
+		if n == nil {
+			return nil
+		}
+		n = n.children[name]
+	}
+	if n == nil {
+		return nil
+	}
+	return n.command
+}
+
+// Returns usage line of command, e.g. `mod ban <target> <reason>`. prefix is prepended as is.
+func (co *Command) Usage(prefix string) string {
+	var sb strings.Builder
+	sb.WriteString(prefix)
+	sb.WriteString(co.Name)
+	if len(co.Subcommands) != 0 && co.Callback == nil {
+		sb.WriteString(" <subcommand>")
+	}
+	for _, o := range co.Options {
+		sb.WriteString(" <")
+		sb.WriteString(o.GetName())
+		sb.WriteByte('>')
+	}
+	return sb.String()
+}
+
+// Returns help text listing command's description, options and subcommands.
+// prefix is prepended to usage, e.g. `!mod ` for subcommands of mod.
+func (co *Command) HelpText(prefix string) string {
+	var sb strings.Builder
+	sb.WriteString(co.Usage(prefix))
+	if len(co.Aliases) != 0 {
+		sb.WriteString("\nAliases: ")
+		sb.WriteString(strings.Join(co.Aliases, ", "))
+	}
+	for _, s := range []string{co.Description, co.Help} {
+		if len(s) != 0 {
+			sb.WriteString("\n")
+			sb.WriteString(s)
+		}
+	}
+	if len(co.Options) != 0 {
+		sb.WriteString("\n\nOptions:")
+		for _, o := range co.Options {
+			sb.WriteString("\n  ")
+			sb.WriteString(o.GetName())
+			if d := o.GetDescription(); len(d) != 0 {
+				sb.WriteString(" - ")
+				sb.WriteString(d)
+			}
+		}
+	}
+	if len(co.Subcommands) != 0 {
+		sb.WriteString("\n\nSubcommands:")
+		for _, s := range co.Subcommands {
+			sb.WriteString("\n  ")
+			sb.WriteString(s.Name)
+			if len(s.Description) != 0 {
+				sb.WriteString(" - ")
+				sb.WriteString(s.Description)
+			}
+		}
+	}
+	return sb.String()
+}
@@ -0,0 +1,206 @@
+package commands
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// Records which command was invoked with which path and rest option.
+type treeRecorder struct {
+	calls []string
+	errs  []error
+}
+
+func (r *treeRecorder) command(name string, aliases ...string) *Command {
+	return &Command{
+		Name:    name,
+		Aliases: aliases,
+		Options: []Option{StringOption{Name: "rest", Raw: true}},
+		Callback: func(ctx *Context) {
+			var path []string
+			for _, co := range ctx.Path {
+				path = append(path, co.Name)
+			}
+			r.calls = append(r.calls, strings.Join(path, " ")+": "+ctx.Options["rest"].(string))
+		},
+	}
+}
+
+func (r *treeRecorder) run(c *Commands, label, args string) {
+	r.calls, r.errs = nil, nil
+	ctx := testContext(c, "someone", args)
+	ctx.Label = label
+	c.Handle(ctx)
+}
+
+func newTreeCommands(t *testing.T, r *treeRecorder, commands ...*Command) *Commands {
+	c := newTestCommands(t, &testHTTPClient{})
+	c.OnError(func(e *CommandError) {
+		r.errs = append(r.errs, e.Err)
+	})
+	c.Register(commands...)
+	return c
+}
+
+func TestSubcommandDispatch(t *testing.T) {
+	r := &treeRecorder{}
+	mod := r.command("mod", "m")
+	ban := r.command("ban", "b")
+	mod.Subcommands = []*Command{ban, r.command("kick")}
+	// group without callback
+	cfg := &Command{Name: "config", Subcommands: []*Command{r.command("set")}}
+	c := newTreeCommands(t, r, mod, cfg)
+
+	for _, tc := range []struct {
+		label, args string
+		want        []string
+	}{
+		{"mod", "ban someone now", []string{"mod ban: someone now"}},
+		{"mod", "b someone", []string{"mod ban: someone"}},
+		{"m", "kick", []string{"mod kick: "}},
+		// falls through to callback of group with unconsumed input
+		{"mod", "unknown words", []string{"mod: unknown words"}},
+		{"mod", "", []string{"mod: "}},
+		{"config", "set x", []string{"config set: x"}},
+		// subcommands aren't top-level commands
+		{"ban", "someone", nil},
+	} {
+		r.run(c, tc.label, tc.args)
+		if !reflect.DeepEqual(r.calls, tc.want) || len(r.errs) != 0 {
+			t.Errorf("%s %s: calls %q, errors %v; want %q", tc.label, tc.args, r.calls, r.errs, tc.want)
+		}
+	}
+
+	for args, name := range map[string]string{"unknown": "unknown", "": ""} {
+		r.run(c, "config", args)
+		var us UnknownSubcommand
+		if len(r.calls) != 0 || len(r.errs) != 1 || !errors.As(r.errs[0], &us) || us != (UnknownSubcommand{Command: "config", Name: name}) {
+			t.Errorf("config %s: calls %q, errors %v", args, r.calls, r.errs)
+		}
+	}
+}
+
+func TestGroupChecksApplyToSubcommands(t *testing.T) {
+	r := &treeRecorder{}
+	var checked []string
+	check := func(name string) Check {
+		return func(ctx *Context) error {
+			checked = append(checked, name)
+			if ctx.Message.Author != "admin" {
+				return errors.New("not admin")
+			}
+			return nil
+		}
+	}
+	mod := r.command("mod")
+	mod.Checks = []Check{check("mod")}
+	ban := r.command("ban")
+	ban.Checks = []Check{check("ban")}
+	mod.Subcommands = []*Command{ban}
+	c := newTreeCommands(t, r, mod)
+
+	r.run(c, "mod", "ban x")
+	if len(r.calls) != 0 || len(r.errs) != 1 || !reflect.DeepEqual(checked, []string{"mod"}) {
+		t.Fatalf("calls %q, errors %v, checks %v", r.calls, r.errs, checked)
+	}
+	checked = nil
+	ctx := testContext(c, "admin", "ban x")
+	ctx.Label = "mod"
+	c.Handle(ctx)
+	if !reflect.DeepEqual(r.calls, []string{"mod ban: x"}) || !reflect.DeepEqual(checked, []string{"mod", "ban"}) {
+		t.Fatalf("calls %q, checks %v", r.calls, checked)
+	}
+}
+
+func TestAliasPrecedence(t *testing.T) {
+	r := &treeRecorder{}
+	// names take precedence over aliases regardless of order
+	for _, commands := range [][]*Command{
+		{r.command("help", "h", "info"), r.command("info")},
+		{r.command("info"), r.command("help", "h", "info")},
+	} {
+		c := newTreeCommands(t, r, commands...)
+		for label, want := range map[string]string{"info": "info: ", "help": "help: ", "h": "help: "} {
+			r.run(c, label, "")
+			if len(r.calls) != 1 || r.calls[0] != want {
+				t.Errorf("%s: calls %q, want %q", label, r.calls, want)
+			}
+		}
+	}
+	// the first alias wins among aliases
+	c := newTreeCommands(t, r, r.command("a", "x"), r.command("b", "x"))
+	r.run(c, "x", "")
+	if !reflect.DeepEqual(r.calls, []string{"a: "}) {
+		t.Errorf("x: calls %q", r.calls)
+	}
+}
+
+func TestRegisterUnregister(t *testing.T) {
+	r := &treeRecorder{}
+	c := newTreeCommands(t, r, r.command("ping", "p"), r.command("echo"))
+	if c.Find("p") == nil || c.Find("echo") == nil {
+		t.Fatal("registered commands not found")
+	}
+
+	// replaces command with the same name, its old aliases are gone
+	replacement := r.command("ping", "pp")
+	c.Register(replacement)
+	if len(c.Commands) != 2 || c.Find("ping") != replacement || c.Find("pp") != replacement || c.Find("p") != nil {
+		t.Fatalf("after replacing: %v", c.Commands)
+	}
+
+	c.Unregister("ping", "missing")
+	if len(c.Commands) != 1 || c.Find("ping") != nil || c.Find("pp") != nil {
+		t.Fatalf("after unregistering: %v", c.Commands)
+	}
+	r.run(c, "ping", "")
+	if len(r.calls) != 0 {
+		t.Fatalf("unregistered command invoked: %q", r.calls)
+	}
+	r.run(c, "echo", "hi")
+	if !reflect.DeepEqual(r.calls, []string{"echo: hi"}) {
+		t.Fatalf("echo: calls %q", r.calls)
+	}
+
+	// subcommands changed directly are visible after Refresh
+	echo := c.Find("echo")
+	loud := r.command("loud", "l")
+	echo.Subcommands = append(echo.Subcommands, loud)
+	if c.Find("echo", "loud") != nil {
+		t.Fatal("subcommand found before Refresh")
+	}
+	c.Refresh()
+	if c.Find("echo", "l") != loud || c.Find("echo", "l", "x") != nil || c.Find() != nil {
+		t.Fatal("Find after Refresh")
+	}
+	r.run(c, "echo", "loud hi")
+	if !reflect.DeepEqual(r.calls, []string{"echo loud: hi"}) {
+		t.Fatalf("echo loud: calls %q", r.calls)
+	}
+}
+
+func TestUsage(t *testing.T) {
+	r := &treeRecorder{}
+	cfg := &Command{Name: "config", Aliases: []string{"cfg"}, Description: "Configures bot", Subcommands: []*Command{
+		{Name: "set", Description: "Sets value", Options: []Option{StringOption{Name: "key", Description: "Key"}, StringOption{Name: "value"}}},
+	}}
+	if u := cfg.Usage("!"); u != "!config <subcommand>" {
+		t.Errorf("usage: %q", u)
+	}
+	if u := cfg.Subcommands[0].Usage("!config "); u != "!config set <key> <value>" {
+		t.Errorf("usage of subcommand: %q", u)
+	}
+	if u := r.command("echo").Usage(""); u != "echo <rest>" {
+		t.Errorf("usage of command with callback: %q", u)
+	}
+	want := "!config <subcommand>\nAliases: cfg\nConfigures bot\n\nSubcommands:\n  set - Sets value"
+	if h := cfg.HelpText("!"); h != want {
+		t.Errorf("help:\n%s\nwant:\n%s", h, want)
+	}
+	want = "set <key> <value>\nSets value\n\nOptions:\n  key - Key\n  value"
+	if h := cfg.Subcommands[0].HelpText(""); h != want {
+		t.Errorf("help of subcommand:\n%s\nwant:\n%s", h, want)
+	}
+}
@@ -19,24 +19,166 @@ func NewCustomEmoji(emoji ULID) *Emoji {
 	return &Emoji{ID: emoji}
 }
 
+// Parses emoji as it is used in reactions or message content: custom emoji is either ULID or `:ULID:`,
+// anything else is treated as unicode emoji. Shortcodes like `:name:` must be resolved with ResolveEmoji.
+func ParseEmoji(s string) Emoji {
+	s = strings.TrimSpace(s)
+	if len(s) == ulidLength+2 && s[0] == ':' && s[len(s)-1] == ':' {
+		if id, err := ParseULID(s[1 : len(s)-1]); err == nil {
+			return Emoji{ID: id}
+		}
+	}
+	if id, err := ParseULID(s); err == nil {
+		return Emoji{ID: id}
+	}
+	return Emoji{Emoji: s}
+}
+
+func (e Emoji) IsCustom() bool {
+	return len(e.ID) != 0
+}
+
+// Returns emoji in format used by reactions: ID for custom emoji, emoji itself otherwise.
+func (e Emoji) String() string {
+	if e.IsCustom() {
+		return string(e.ID)
+	}
+	return e.Emoji
+}
+
+// Returns emoji in format which can be embedded in message content.
+func (e Emoji) Markdown() string {
+	if e.IsCustom() {
+		return ":" + string(e.ID) + ":"
+	}
+	return e.Emoji
+}
+
 func (e Emoji) EncodeFP() string {
-	if len(e.ID) != 0 {
+	if e.IsCustom() {
 		return e.ID.EncodeFP()
 	}
 	return url.PathEscape(e.Emoji)
 }
 
+func (e Emoji) MarshalJSON() ([]byte, error) {
+	return json.Marshal(e.String())
+}
+
 func (e *Emoji) UnmarshalJSON(b []byte) error {
 	var s string
 	if err := json.Unmarshal(b, &s); err != nil {
 		return err
 	}
-	if strings.Contains(s[:1], "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZ") {
-		// custom emoji
-		e.ID = ULID(s)
-	} else {
-		// unicode emoji
-		e.Emoji = s
-	}
+	*e = ParseEmoji(s)
 	return nil
 }
+
+// Custom emoji reference found in message content.
+type EmojiReference struct {
+	ID ULID
+	// Byte offsets of the reference (including colons) in content
+	Start, End int
+}
+
+// Finds custom emoji references (`:ULID:`) in message content.
+func FindCustomEmojis(content string) []EmojiReference {
+	var a []EmojiReference
+	for i := 0; i+ulidLength+2 <= len(content); {
+		if content[i] != ':' || content[i+ulidLength+1] != ':' {
+			i++
+			continue
+		}
+		id, err := ParseULID(content[i+1 : i+ulidLength+1])
+		if err != nil {
+			i++
+			continue
+		}
+		a = append(a, EmojiReference{ID: id, Start: i, End: i + ulidLength + 2})
+		i += ulidLength + 2
+	}
+	return a
+}
+
+type UnknownEmoji struct {
+	Name string
+}
+
+func (ue UnknownEmoji) Error() string {
+	return "unknown emoji: " + ue.Name
+}
+
+func emojiShortcode(s string) (string, bool) {
+	if len(s) > 2 && s[0] == ':' && s[len(s)-1] == ':' {
+		return s[1 : len(s)-1], true
+	}
+	return "", false
+}
+
+// Resolves emoji written as ULID, `:ULID:`, `:name:` or unicode emoji. Shortcodes are looked up
+// in emojis by name (case sensitive match is preferred), UnknownEmoji is returned if there is no such emoji.
+func ResolveEmoji(s string, emojis []*OptimizedCustomEmoji) (Emoji, error) {
+	e := ParseEmoji(s)
+	if e.IsCustom() {
+		return e, nil
+	}
+	name, ok := emojiShortcode(e.Emoji)
+	if !ok {
+		return e, nil
+	}
+	var fold *OptimizedCustomEmoji
+	for _, c := range emojis {
+		if c.Name == name {
+			return Emoji{ID: c.ID}, nil
+		}
+		if fold == nil && strings.EqualFold(c.Name, name) {
+			fold = c
+		}
+	}
+	if fold != nil {
+		return Emoji{ID: fold.ID}, nil
+	}
+	return Emoji{}, UnknownEmoji{Name: name}
+}
+
+// Returns cached emojis of server.
+func (gc *GenericCache) ServerEmojis(server ULID) []*OptimizedCustomEmoji {
+	var a []*OptimizedCustomEmoji
+	gc.Emojis.Range(func(e *OptimizedCustomEmoji) bool {
+		if e.Parent != nil && e.Parent.Type == OptimizedCustomEmojiParentTypeServer && e.Parent.ID == server {
+			a = append(a, e)
+		}
+		return true
+	})
+	return a
+}
+
+// Same as ResolveEmoji, but shortcodes are looked up in cached emojis of server.
+func (gc *GenericCache) ResolveEmoji(server ULID, s string) (Emoji, error) {
+	return ResolveEmoji(s, gc.ServerEmojis(server))
+}
+
+// Same as ResolveEmoji, but shortcodes are looked up in emojis of server. If shortcode isn't found
+// in cache, server emojis are fetched and cached.
+func (c *Client) ResolveEmoji(server ULID, s string) (Emoji, error) {
+	e, err := c.Cache.ResolveEmoji(server, s)
+	if _, ok := err.(UnknownEmoji); !ok {
+		return e, err
+	}
+	v, err := c.group.do(c.context(), "servers/"+string(server)+"/emojis", func() (any, error) {
+		a, err := c.API.FetchServerEmojis(server)
+		if err != nil {
+			return nil, err
+		}
+		o := make([]*OptimizedCustomEmoji, len(a))
+		for i, e := range a {
+			o[i] = e.ToOptimized()
+			c.Cache.Emojis.Set(snapshot(o[i]))
+		}
+		return o, nil
+	})
+	if err != nil {
+		return Emoji{}, err
+	}
+	return ResolveEmoji(s, v.([]*OptimizedCustomEmoji))
+}
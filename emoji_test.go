@@ -0,0 +1,169 @@
+package regolt
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+const (
+	testEmoji1 ULID = "01HBX8K2E6RVJ9ZQ3F7T5W0M1A"
+	testEmoji2 ULID = "01HBX8K2E6RVJ9ZQ3F7T5W0M1B"
+)
+
+func TestParseEmoji(t *testing.T) {
+	for in, want := range map[string]Emoji{
+		string(testEmoji1):             {ID: testEmoji1},
+		":" + string(testEmoji1) + ":": {ID: testEmoji1},
+		// normalized
+		"01hbx8k2e6rvj9zq3f7t5w0m1a":     {ID: testEmoji1},
+		" :" + string(testEmoji1) + ": ": {ID: testEmoji1},
+		"👍":                              {Emoji: "👍"},
+		":thumbsup:":                     {Emoji: ":thumbsup:"},
+		":" + string(testEmoji1):         {Emoji: ":" + string(testEmoji1)},
+		// overflows 128 bits
+		"ZZZZZZZZZZZZZZZZZZZZZZZZZZ": {Emoji: "ZZZZZZZZZZZZZZZZZZZZZZZZZZ"},
+		"":                           {},
+		"   ":                        {},
+		":":                          {Emoji: ":"},
+		"::":                         {Emoji: "::"},
+	} {
+		got := ParseEmoji(in)
+		if got != want {
+			t.Errorf("ParseEmoji(%q) = %+v, want %+v", in, got, want)
+		}
+		if got.IsCustom() != (len(want.ID) != 0) {
+			t.Errorf("ParseEmoji(%q).IsCustom() = %v", in, got.IsCustom())
+		}
+	}
+}
+
+func TestEmojiFormats(t *testing.T) {
+	custom, unicode := NewCustomEmoji(testEmoji1), NewUnicodeEmoji("🎉")
+	if s := custom.String(); s != string(testEmoji1) {
+		t.Errorf("custom String: %q", s)
+	}
+	if s := custom.Markdown(); s != ":"+string(testEmoji1)+":" {
+		t.Errorf("custom Markdown: %q", s)
+	}
+	if s := unicode.String(); s != "🎉" {
+		t.Errorf("unicode String: %q", s)
+	}
+	if s := unicode.Markdown(); s != "🎉" {
+		t.Errorf("unicode Markdown: %q", s)
+	}
+	if s := unicode.EncodeFP(); s != url.PathEscape("🎉") {
+		t.Errorf("unicode EncodeFP: %q", s)
+	}
+}
+
+func TestEmojiJSON(t *testing.T) {
+	for _, e := range []Emoji{{ID: testEmoji1}, {Emoji: "🎉"}, {Emoji: ":name:"}} {
+		b, err := json.Marshal(e)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want, _ := json.Marshal(e.String()); string(b) != string(want) {
+			t.Errorf("marshaled %+v as %s", e, b)
+		}
+		var got Emoji
+		if err := json.Unmarshal(b, &got); err != nil {
+			t.Fatal(err)
+		}
+		if got != e {
+			t.Errorf("round trip of %+v: %+v", e, got)
+		}
+	}
+	var e Emoji
+	if err := json.Unmarshal([]byte(`":`+string(testEmoji2)+`:"`), &e); err != nil || e != (Emoji{ID: testEmoji2}) {
+		t.Errorf("unmarshaled markdown emoji: %+v, %v", e, err)
+	}
+	if err := json.Unmarshal([]byte(`1`), &e); err == nil {
+		t.Error("unmarshaled number as emoji")
+	}
+}
+
+func TestFindCustomEmojis(t *testing.T) {
+	id1, id2 := ":"+string(testEmoji1)+":", ":"+string(testEmoji2)+":"
+	for content, want := range map[string][]EmojiReference{
+		"":                      nil,
+		"no emojis :here:":      nil,
+		id1:                     {{ID: testEmoji1, Start: 0, End: 28}},
+		"hi " + id1 + id2 + "!": {{ID: testEmoji1, Start: 3, End: 31}, {ID: testEmoji2, Start: 31, End: 59}},
+		// colon before reference doesn't hide it
+		":" + id1:                           {{ID: testEmoji1, Start: 1, End: 29}},
+		"::" + string(testEmoji1)[1:] + id2: {{ID: testEmoji2, Start: 27, End: 55}},
+		// lowercase references are normalized
+		":01hbx8k2e6rvj9zq3f7t5w0m1a:": {{ID: testEmoji1, Start: 0, End: 28}},
+		// reference is too short
+		id1[:27]: nil,
+	} {
+		if got := FindCustomEmojis(content); !reflect.DeepEqual(got, want) {
+			t.Errorf("FindCustomEmojis(%q) = %+v, want %+v", content, got, want)
+		}
+	}
+}
+
+func TestResolveEmoji(t *testing.T) {
+	emojis := []*OptimizedCustomEmoji{
+		{ID: testEmoji1, Name: "Party"},
+		{ID: testEmoji2, Name: "party"},
+	}
+	for _, c := range []struct {
+		in   string
+		want Emoji
+		err  error
+	}{
+		{":party:", Emoji{ID: testEmoji2}, nil},
+		{":Party:", Emoji{ID: testEmoji1}, nil},
+		// case insensitive match is the fallback
+		{":PARTY:", Emoji{ID: testEmoji1}, nil},
+		{":" + string(testEmoji2) + ":", Emoji{ID: testEmoji2}, nil},
+		{string(testEmoji1), Emoji{ID: testEmoji1}, nil},
+		{"🎉", Emoji{Emoji: "🎉"}, nil},
+		{"::", Emoji{Emoji: "::"}, nil},
+		{":unknown:", Emoji{}, UnknownEmoji{Name: "unknown"}},
+	} {
+		got, err := ResolveEmoji(c.in, emojis)
+		if got != c.want || err != c.err {
+			t.Errorf("ResolveEmoji(%q) = %+v, %v; want %+v, %v", c.in, got, err, c.want, c.err)
+		}
+	}
+}
+
+func TestClientResolveEmoji(t *testing.T) {
+	hc := &testHTTPClient{handler: func(r *http.Request) (int, string) {
+		if r.URL.Path == "/servers/s1/emojis" {
+			return 200, `[{"_id":"` + string(testEmoji2) + `","parent":{"type":"Server","id":"s1"},"creator_id":"u1","name":"fetched"}]`
+		}
+		return 404, `{"type":"NotFound"}`
+	}}
+	apiURL, _ := url.Parse("http://api.test/")
+	api, err := NewAPI(nil, &APIConfig{HTTPClient: hc, URL: apiURL, DisableRateLimiter: true, MaxRetries: -1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := NewClient(api, &GenericCache{Emojis: &Cache1[OptimizedCustomEmoji]{MaxSize: -1}})
+	c.Cache.Emojis.Set(&OptimizedCustomEmoji{
+		ID:     testEmoji1,
+		Name:   "cached",
+		Parent: &OptimizedCustomEmojiParent{Type: OptimizedCustomEmojiParentTypeServer, ID: "s1"},
+	})
+	if e, err := c.ResolveEmoji("s1", ":cached:"); err != nil || e.ID != testEmoji1 || len(hc.requests) != 0 {
+		t.Fatalf("cached emoji: %+v, %v, requests %v", e, err, hc.requests)
+	}
+	if e, err := c.ResolveEmoji("s1", ":fetched:"); err != nil || e.ID != testEmoji2 || len(hc.requests) != 1 {
+		t.Fatalf("fetched emoji: %+v, %v, requests %v", e, err, hc.requests)
+	}
+	// fetched emojis are cached
+	if e, err := c.ResolveEmoji("s1", ":fetched:"); err != nil || e.ID != testEmoji2 || len(hc.requests) != 1 {
+		t.Fatalf("emoji fetched before: %+v, %v, requests %v", e, err, hc.requests)
+	}
+	var ue UnknownEmoji
+	if _, err := c.ResolveEmoji("s1", ":missing:"); !errors.As(err, &ue) || ue.Name != "missing" {
+		t.Fatalf("missing emoji: %v", err)
+	}
+}
@@ -0,0 +1,234 @@
+package regolt
+
+import (
+	"errors"
+	"strconv"
+	"time"
+)
+
+// Errors returned by Revolt which don't carry any data. APIError wraps them,
+// so they can be checked with errors.Is, e.g. `errors.Is(err, regolt.ErrNotFound)`.
+var (
+	ErrLabelMe                        = errors.New("LabelMe")
+	ErrAlreadyOnboarded               = errors.New("AlreadyOnboarded")
+	ErrUsernameTaken                  = errors.New("UsernameTaken")
+	ErrInvalidUsername                = errors.New("InvalidUsername")
+	ErrDiscriminatorChangeRatelimited = errors.New("DiscriminatorChangeRatelimited")
+	ErrUnknownUser                    = errors.New("UnknownUser")
+	ErrAlreadyFriends                 = errors.New("AlreadyFriends")
+	ErrAlreadySentRequest             = errors.New("AlreadySentRequest")
+	ErrBlocked                        = errors.New("Blocked")
+	ErrBlockedByOther                 = errors.New("BlockedByOther")
+	ErrNotFriends                     = errors.New("NotFriends")
+	ErrUnknownChannel                 = errors.New("UnknownChannel")
+	ErrUnknownAttachment              = errors.New("UnknownAttachment")
+	ErrUnknownMessage                 = errors.New("UnknownMessage")
+	ErrCannotEditMessage              = errors.New("CannotEditMessage")
+	ErrCannotJoinCall                 = errors.New("CannotJoinCall")
+	ErrEmptyMessage                   = errors.New("EmptyMessage")
+	ErrPayloadTooLarge                = errors.New("PayloadTooLarge")
+	ErrCannotRemoveYourself           = errors.New("CannotRemoveYourself")
+	ErrAlreadyInGroup                 = errors.New("AlreadyInGroup")
+	ErrNotInGroup                     = errors.New("NotInGroup")
+	ErrUnknownServer                  = errors.New("UnknownServer")
+	ErrInvalidRole                    = errors.New("InvalidRole")
+	ErrBanned                         = errors.New("Banned")
+	ErrAlreadyInServer                = errors.New("AlreadyInServer")
+	ErrReachedMaximumBots             = errors.New("ReachedMaximumBots")
+	ErrIsBot                          = errors.New("IsBot")
+	ErrBotIsPrivate                   = errors.New("BotIsPrivate")
+	ErrCannotReportYourself           = errors.New("CannotReportYourself")
+	ErrNotElevated                    = errors.New("NotElevated")
+	ErrNotPrivileged                  = errors.New("NotPrivileged")
+	ErrCannotGiveMissingPermissions   = errors.New("CannotGiveMissingPermissions")
+	ErrNotOwner                       = errors.New("NotOwner")
+	ErrInternalError                  = errors.New("InternalError")
+	ErrInvalidOperation               = errors.New("InvalidOperation")
+	ErrInvalidCredentials             = errors.New("InvalidCredentials")
+	ErrInvalidProperty                = errors.New("InvalidProperty")
+	ErrInvalidSession                 = errors.New("InvalidSession")
+	ErrDuplicateNonce                 = errors.New("DuplicateNonce")
+	ErrNotFound                       = errors.New("NotFound")
+	ErrNoEffect                       = errors.New("NoEffect")
+	ErrVosoUnavailable                = errors.New("VosoUnavailable")
+)
+
+var revoltErrors = map[string]error{}
+
+func init() {
+	for _, err := range []error{
+		ErrLabelMe, ErrAlreadyOnboarded, ErrUsernameTaken, ErrInvalidUsername, ErrDiscriminatorChangeRatelimited,
+		ErrUnknownUser, ErrAlreadyFriends, ErrAlreadySentRequest, ErrBlocked, ErrBlockedByOther, ErrNotFriends,
+		ErrUnknownChannel, ErrUnknownAttachment, ErrUnknownMessage, ErrCannotEditMessage, ErrCannotJoinCall,
+		ErrEmptyMessage, ErrPayloadTooLarge, ErrCannotRemoveYourself, ErrAlreadyInGroup, ErrNotInGroup,
+		ErrUnknownServer, ErrInvalidRole, ErrBanned, ErrAlreadyInServer, ErrReachedMaximumBots, ErrIsBot,
+		ErrBotIsPrivate, ErrCannotReportYourself, ErrNotElevated, ErrNotPrivileged, ErrCannotGiveMissingPermissions,
+		ErrNotOwner, ErrInternalError, ErrInvalidOperation, ErrInvalidCredentials, ErrInvalidProperty,
+		ErrInvalidSession, ErrDuplicateNonce, ErrNotFound, ErrNoEffect, ErrVosoUnavailable,
+	} {
+		revoltErrors[err.Error()] = err
+	}
+}
+
+// Errors below carry data and are matched with errors.As, e.g.
+// `var mp regolt.ErrMissingPermission; if errors.As(err, &mp) { ... }`.
+
+type ErrMissingPermission struct {
+	Permission string
+}
+
+func (e ErrMissingPermission) Error() string {
+	return "missing permission: " + e.Permission
+}
+
+type ErrMissingUserPermission struct {
+	Permission string
+}
+
+func (e ErrMissingUserPermission) Error() string {
+	return "missing user permission: " + e.Permission
+}
+
+type ErrRateLimited struct {
+	RetryAfter time.Duration
+}
+
+func (e ErrRateLimited) Error() string {
+	return "rate limited, retry after " + e.RetryAfter.String()
+}
+
+type ErrDatabaseError struct {
+	Operation  string
+	Collection string
+}
+
+func (e ErrDatabaseError) Error() string {
+	return "database error: " + e.Operation + " on " + e.Collection
+}
+
+type ErrFailedValidation struct {
+	Reason string
+}
+
+func (e ErrFailedValidation) Error() string {
+	return "failed validation: " + e.Reason
+}
+
+// Error returned by Rocket (HTTP framework Revolt uses), e.g. when request body is malformed.
+type ErrRocket struct {
+	Code        int
+	Reason      string
+	Description string
+}
+
+func (e ErrRocket) Error() string {
+	return strconv.Itoa(e.Code) + " " + e.Reason + ": " + e.Description
+}
+
+type ErrTooManyPendingFriendRequests struct {
+	Max int
+}
+
+func (e ErrTooManyPendingFriendRequests) Error() string {
+	return "too many pending friend requests, max is " + strconv.Itoa(e.Max)
+}
+
+type ErrTooManyAttachments struct {
+	Max int
+}
+
+func (e ErrTooManyAttachments) Error() string {
+	return "too many attachments, max is " + strconv.Itoa(e.Max)
+}
+
+type ErrTooManyEmbeds struct {
+	Max int
+}
+
+func (e ErrTooManyEmbeds) Error() string {
+	return "too many embeds, max is " + strconv.Itoa(e.Max)
+}
+
+type ErrTooManyReplies struct {
+	Max int
+}
+
+func (e ErrTooManyReplies) Error() string {
+	return "too many replies, max is " + strconv.Itoa(e.Max)
+}
+
+type ErrTooManyChannels struct {
+	Max int
+}
+
+func (e ErrTooManyChannels) Error() string {
+	return "too many channels, max is " + strconv.Itoa(e.Max)
+}
+
+type ErrGroupTooLarge struct {
+	Max int
+}
+
+func (e ErrGroupTooLarge) Error() string {
+	return "group too large, max is " + strconv.Itoa(e.Max)
+}
+
+type ErrTooManyServers struct {
+	Max int
+}
+
+func (e ErrTooManyServers) Error() string {
+	return "too many servers, max is " + strconv.Itoa(e.Max)
+}
+
+type ErrTooManyEmoji struct {
+	Max int
+}
+
+func (e ErrTooManyEmoji) Error() string {
+	return "too many emoji, max is " + strconv.Itoa(e.Max)
+}
+
+type ErrTooManyRoles struct {
+	Max int
+}
+
+func (e ErrTooManyRoles) Error() string {
+	return "too many roles, max is " + strconv.Itoa(e.Max)
+}
+
+// Returns typed error for ae, nil if the type is unknown.
+func (ae *APIError) variant() error {
+	if ae.StatusCode == 429 {
+		return ErrRateLimited{RetryAfter: time.Duration(ae.RetryAfter * float64(time.Millisecond))}
+	}
+	switch ae.Type {
+	case "MissingPermission":
+		return ErrMissingPermission{Permission: ae.Permission}
+	case "MissingUserPermission":
+		return ErrMissingUserPermission{Permission: ae.Permission}
+	case "DatabaseError":
+		return ErrDatabaseError{Operation: ae.Operation, Collection: ae.Collection}
+	case "FailedValidation":
+		return ErrFailedValidation{Reason: ae.Err}
+	case "TooManyPendingFriendRequests":
+		return ErrTooManyPendingFriendRequests{Max: ae.Max}
+	case "TooManyAttachments":
+		return ErrTooManyAttachments{Max: ae.Max}
+	case "TooManyEmbeds":
+		return ErrTooManyEmbeds{Max: ae.Max}
+	case "TooManyReplies":
+		return ErrTooManyReplies{Max: ae.Max}
+	case "TooManyChannels":
+		return ErrTooManyChannels{Max: ae.Max}
+	case "GroupTooLarge":
+		return ErrGroupTooLarge{Max: ae.Max}
+	case "TooManyServers":
+		return ErrTooManyServers{Max: ae.Max}
+	case "TooManyEmoji":
+		return ErrTooManyEmoji{Max: ae.Max}
+	case "TooManyRoles":
+		return ErrTooManyRoles{Max: ae.Max}
+	}
+	return revoltErrors[ae.Type]
+}
@@ -0,0 +1,124 @@
+package regolt
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testResponse(status int, body string) *http.Response {
+	return &http.Response{
+		StatusCode: status,
+		Header:     http.Header{"Content-Type": {"application/json"}},
+		Body:       io.NopCloser(strings.NewReader(body)),
+	}
+}
+
+func TestHandleResponseErrors(t *testing.T) {
+	api, err := NewAPI(nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []struct {
+		status int
+		body   string
+		// checks returned error
+		check func(error) bool
+		text  string
+	}{
+		{404, `{"type":"NotFound"}`, func(err error) bool {
+			return errors.Is(err, ErrNotFound) && !errors.Is(err, ErrUnknownUser)
+		}, "NotFound"},
+		{400, `{"type":"UsernameTaken"}`, func(err error) bool {
+			return errors.Is(err, ErrUsernameTaken)
+		}, "UsernameTaken"},
+		{403, `{"type":"MissingPermission","permission":"BanMembers"}`, func(err error) bool {
+			var mp ErrMissingPermission
+			return errors.As(err, &mp) && mp.Permission == "BanMembers"
+		}, "MissingPermission: permission: BanMembers"},
+		{403, `{"type":"MissingUserPermission","permission":"SendMessage"}`, func(err error) bool {
+			var mp ErrMissingUserPermission
+			return errors.As(err, &mp) && mp.Permission == "SendMessage" && !errors.As(err, &ErrMissingPermission{})
+		}, "MissingUserPermission: permission: SendMessage"},
+		{400, `{"type":"TooManyAttachments","max":5}`, func(err error) bool {
+			var e ErrTooManyAttachments
+			return errors.As(err, &e) && e.Max == 5
+		}, "TooManyAttachments: max: 5"},
+		{500, `{"type":"DatabaseError","operation":"find_one","collection":"users"}`, func(err error) bool {
+			var e ErrDatabaseError
+			return errors.As(err, &e) && e == ErrDatabaseError{Operation: "find_one", Collection: "users"}
+		}, "DatabaseError: operation: find_one, collection: users"},
+		{400, `{"type":"FailedValidation","error":"name is too long"}`, func(err error) bool {
+			var e ErrFailedValidation
+			return errors.As(err, &e) && e.Reason == "name is too long"
+		}, "FailedValidation: name is too long"},
+		{422, `{"error":{"code":422,"reason":"Unprocessable Entity","description":"The request was well-formed but was unable to be followed due to semantic errors."}}`, func(err error) bool {
+			var e ErrRocket
+			return errors.As(err, &e) && e.Code == 422 && e.Reason == "Unprocessable Entity" && strings.HasPrefix(e.Description, "The request")
+		}, "Rocket error: 422 Unprocessable Entity: The request was well-formed but was unable to be followed due to semantic errors."},
+		{429, `{"retry_after":1500}`, func(err error) bool {
+			var e ErrRateLimited
+			return errors.As(err, &e) && e.RetryAfter == 1500*time.Millisecond
+		}, "HTTP 429"},
+		// unknown type has no typed error
+		{400, `{"type":"SomethingNew"}`, func(err error) bool {
+			return errors.Unwrap(err) == nil
+		}, "SomethingNew"},
+		// e.g. response of proxy
+		{502, `<html>Bad Gateway</html>`, func(err error) bool {
+			var ae APIError
+			return errors.As(err, &ae) && string(ae.Body) == `<html>Bad Gateway</html>` && errors.Unwrap(err) == nil
+		}, "HTTP 502"},
+		{503, ``, func(err error) bool {
+			return errors.Unwrap(err) == nil
+		}, "HTTP 503"},
+	} {
+		err := handleResponse(api, testResponse(c.status, c.body))
+		var ae APIError
+		if !errors.As(err, &ae) || ae.StatusCode != c.status {
+			t.Errorf("%d %s: %v isn't APIError", c.status, c.body, err)
+			continue
+		}
+		if !c.check(err) {
+			t.Errorf("%d %s: unexpected error %#v", c.status, c.body, err)
+		}
+		if err.Error() != c.text {
+			t.Errorf("%d %s: error text %q, want %q", c.status, c.body, err.Error(), c.text)
+		}
+	}
+	if err := handleResponse(api, testResponse(200, `{}`)); err != nil {
+		t.Fatalf("200: %v", err)
+	}
+}
+
+func TestAPIErrorsThroughRequest(t *testing.T) {
+	hc := &testHTTPClient{handler: func(r *http.Request) (int, string) {
+		switch r.URL.Path {
+		case "/users/u1":
+			return 404, `{"type":"NotFound"}`
+		case "/channels/c1/messages":
+			return 403, `{"type":"MissingPermission","permission":"SendMessage"}`
+		}
+		return 429, `{"retry_after":10}`
+	}}
+	apiURL, _ := url.Parse("http://api.test/")
+	api, err := NewAPI(nil, &APIConfig{HTTPClient: hc, URL: apiURL, DisableRateLimiter: true, MaxRetries: -1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := api.FetchUser("u1"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("FetchUser: %v", err)
+	}
+	var mp ErrMissingPermission
+	if _, err := api.SendMessage("c1", &SendMessage{Content: "hi"}); !errors.As(err, &mp) || mp.Permission != "SendMessage" {
+		t.Errorf("SendMessage: %v", err)
+	}
+	var rl ErrRateLimited
+	if _, err := api.FetchChannel("c2"); !errors.As(err, &rl) || rl.RetryAfter != 10*time.Millisecond {
+		t.Errorf("FetchChannel: %v", err)
+	}
+}
@@ -1,6 +1,9 @@
 package regolt
 
+import "sync"
+
 type EventController[T any] struct {
+	mu sync.RWMutex
 	ls map[int]func(T)
 	id int
 }
@@ -16,45 +19,59 @@ type Subscription[T any] struct {
 }
 
 func (s *Subscription[T]) Delete() {
+	s.Controller.mu.Lock()
 	delete(s.Controller.ls, s.ID)
+	s.Controller.mu.Unlock()
 }
 
 func (ec *EventController[T]) Listen(f func(T)) *Subscription[T] {
+	ec.mu.Lock()
+	defer ec.mu.Unlock()
 	i := ec.inc()
 	ec.ls[i] = f
 	return &Subscription[T]{Controller: ec, ID: i}
 }
 
 func (ec *EventController[T]) Override(f func(T)) *Subscription[T] {
+	ec.mu.Lock()
 	clear(ec.ls)
+	ec.mu.Unlock()
 	return ec.Listen(f)
 }
 
+func (ec *EventController[T]) count() int {
+	ec.mu.RLock()
+	defer ec.mu.RUnlock()
+	return len(ec.ls)
+}
+
 func (ec *EventController[T]) Emit(t T) *EventController[T] {
+	// listeners may subscribe or unsubscribe while being called
+	ec.mu.RLock()
+	ls := make([]func(T), 0, len(ec.ls))
 	for _, g := range ec.ls {
+		ls = append(ls, g)
+	}
+	ec.mu.RUnlock()
+	for _, g := range ls {
 		g(t)
 	}
 	return ec
 }
 
 func (ec *EventController[T]) EmitInGoroutines(t T) *EventController[T] {
-	if len(ec.ls) == 0 {
+	if ec.count() == 0 {
 		return ec
 	}
 	go ec.Emit(t)
 	return ec
 }
 
+// Calls f synchronously, so updates of consecutive events are applied in order, then emits t to listeners
+// in goroutine. Listeners observe the state after f.
 func (ec *EventController[T]) EmitAndCall(t T, f func(T)) *EventController[T] {
-	if len(ec.ls) == 0 {
-		f(t)
-		return ec
-	}
-	go func(x *EventController[T], y T, z func(T)) {
-		x.Emit(y)
-		z(y)
-	}(ec, t, f)
-	return ec
+	f(t)
+	return ec.EmitInGoroutines(t)
 }
 
 func NewEventController[T any]() *EventController[T] {
@@ -0,0 +1,413 @@
+package regolt
+
+import (
+	"container/heap"
+	"container/list"
+	"sync"
+	"time"
+)
+
+// EvictionPolicy decides which entity is removed from a bounded cache when it overflows and which
+// entities expire. Cache1 uses ULID keys, Cache2 uses Cache2Key keys.
+// Caches may call policy methods concurrently (e.g. Accessed from Get), so implementations must be safe for
+// concurrent use.
+type EvictionPolicy[K comparable] interface {
+	// Called after entity was inserted or replaced.
+	Inserted(key K)
+	// Called after entity was returned from Get.
+	Accessed(key K)
+	// Called after entity was removed from cache for any reason.
+	Removed(key K)
+	// Returns entity which should be evicted. Only entities for which allow returns true can be chosen,
+	// nil allows all. If nothing can be evicted, returns false and the new entity is not inserted.
+	Victim(allow func(K) bool) (K, bool)
+	// Reports whether entity is still valid at now.
+	Valid(key K, now time.Time) bool
+	// Returns entities which expired at now.
+	Expired(now time.Time) []K
+}
+
+// Identifies entity in Cache2.
+type Cache2Key struct {
+	Parent ULID
+	ID     ULID
+}
+
+// Evicts least recently used entity.
+type LRUPolicy[K comparable] struct {
+	mu    sync.Mutex
+	order *list.List
+	items map[K]*list.Element
+}
+
+func NewLRUPolicy[K comparable]() *LRUPolicy[K] {
+	return &LRUPolicy[K]{
+		order: list.New(),
+		items: map[K]*list.Element{},
+	}
+}
+
+func (p *LRUPolicy[K]) Inserted(key K) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if e, ok := p.items[key]; ok {
+		p.order.MoveToFront(e)
+		return
+	}
+	p.items[key] = p.order.PushFront(key)
+}
+
+func (p *LRUPolicy[K]) Accessed(key K) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	// entity may be removed after Get released the lock
+	if e, ok := p.items[key]; ok {
+		p.order.MoveToFront(e)
+	}
+}
+
+func (p *LRUPolicy[K]) Removed(key K) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if e, ok := p.items[key]; ok {
+		p.order.Remove(e)
+		delete(p.items, key)
+	}
+}
+
+func (p *LRUPolicy[K]) Victim(allow func(K) bool) (key K, ok bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for e := p.order.Back(); e != nil; e = e.Prev() {
+		k := e.Value.(K)
+		if allow == nil || allow(k) {
+			return k, true
+		}
+	}
+	return
+}
+
+func (*LRUPolicy[K]) Valid(K, time.Time) bool {
+	return true
+}
+
+func (*LRUPolicy[K]) Expired(time.Time) []K {
+	return nil
+}
+
+// Entry of priorityQueue, entries with lower (primary, secondary) come first.
+type priorityEntry[K comparable] struct {
+	key       K
+	primary   int64
+	secondary int64
+	index     int
+}
+
+func (e *priorityEntry[K]) less(f *priorityEntry[K]) bool {
+	return e.primary < f.primary || (e.primary == f.primary && e.secondary < f.secondary)
+}
+
+// Min-heap used by policies, so victims and expired entities are found without scanning all entities.
+type priorityQueue[K comparable] []*priorityEntry[K]
+
+func (q priorityQueue[K]) Len() int {
+	return len(q)
+}
+
+func (q priorityQueue[K]) Less(i, j int) bool {
+	return q[i].less(q[j])
+}
+
+func (q priorityQueue[K]) Swap(i, j int) {
+	q[i], q[j] = q[j], q[i]
+	q[i].index = i
+	q[j].index = j
+}
+
+func (q *priorityQueue[K]) Push(x any) {
+	e := x.(*priorityEntry[K])
+	e.index = len(*q)
+	*q = append(*q, e)
+}
+
+func (q *priorityQueue[K]) Pop() any {
+	old := *q
+	n := len(old) - 1
+	e := old[n]
+	old[n] = nil
+	*q = old[:n]
+	return e
+}
+
+// Heap of indices into priorityQueue, used to walk the queue in order.
+type priorityIndices[K comparable] struct {
+	q       priorityQueue[K]
+	indices []int
+}
+
+func (h *priorityIndices[K]) Len() int {
+	return len(h.indices)
+}
+
+func (h *priorityIndices[K]) Less(i, j int) bool {
+	return h.q[h.indices[i]].less(h.q[h.indices[j]])
+}
+
+func (h *priorityIndices[K]) Swap(i, j int) {
+	h.indices[i], h.indices[j] = h.indices[j], h.indices[i]
+}
+
+func (h *priorityIndices[K]) Push(x any) {
+	h.indices = append(h.indices, x.(int))
+}
+
+func (h *priorityIndices[K]) Pop() any {
+	n := len(h.indices) - 1
+	i := h.indices[n]
+	h.indices = h.indices[:n]
+	return i
+}
+
+// Returns the first entry for which allow returns true, nil allows all. Only entries which come before
+// the result are visited, so it is cheap unless many of them aren't allowed.
+func (q priorityQueue[K]) first(allow func(K) bool) *priorityEntry[K] {
+	if len(q) == 0 {
+		return nil
+	}
+	if allow == nil {
+		return q[0]
+	}
+	h := &priorityIndices[K]{q: q, indices: []int{0}}
+	for h.Len() != 0 {
+		i := heap.Pop(h).(int)
+		if allow(q[i].key) {
+			return q[i]
+		}
+		for _, c := range [2]int{2*i + 1, 2*i + 2} {
+			if c < len(q) {
+				heap.Push(h, c)
+			}
+		}
+	}
+	return nil
+}
+
+// Evicts least frequently used entity, the oldest one if there are several.
+type LFUPolicy[K comparable] struct {
+	mu    sync.Mutex
+	seq   int64
+	items map[K]*priorityEntry[K]
+	// ordered by hits, then by insertion order
+	queue priorityQueue[K]
+}
+
+func NewLFUPolicy[K comparable]() *LFUPolicy[K] {
+	return &LFUPolicy[K]{
+		items: map[K]*priorityEntry[K]{},
+	}
+}
+
+func (p *LFUPolicy[K]) Inserted(key K) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if _, ok := p.items[key]; ok {
+		return
+	}
+	p.seq++
+	e := &priorityEntry[K]{key: key, secondary: p.seq}
+	p.items[key] = e
+	heap.Push(&p.queue, e)
+}
+
+func (p *LFUPolicy[K]) Accessed(key K) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if e, ok := p.items[key]; ok {
+		e.primary++
+		heap.Fix(&p.queue, e.index)
+	}
+}
+
+func (p *LFUPolicy[K]) Removed(key K) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if e, ok := p.items[key]; ok {
+		heap.Remove(&p.queue, e.index)
+		delete(p.items, key)
+	}
+}
+
+func (p *LFUPolicy[K]) Victim(allow func(K) bool) (key K, ok bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if e := p.queue.first(allow); e != nil {
+		return e.key, true
+	}
+	return
+}
+
+func (*LFUPolicy[K]) Valid(K, time.Time) bool {
+	return true
+}
+
+func (*LFUPolicy[K]) Expired(time.Time) []K {
+	return nil
+}
+
+// Expires entities after TTL and evicts the one which expires first on overflow.
+type TTLPolicy[K comparable] struct {
+	TTL time.Duration
+	// Whether Get extends lifetime of entity.
+	RefreshOnAccess bool
+	mu              sync.Mutex
+	items           map[K]*priorityEntry[K]
+	// ordered by deadline (Unix nanoseconds)
+	queue priorityQueue[K]
+}
+
+func NewTTLPolicy[K comparable](ttl time.Duration, refreshOnAccess bool) *TTLPolicy[K] {
+	return &TTLPolicy[K]{
+		TTL:             ttl,
+		RefreshOnAccess: refreshOnAccess,
+		items:           map[K]*priorityEntry[K]{},
+	}
+}
+
+// Must be called with lock held.
+func (p *TTLPolicy[K]) setDeadline(key K, deadline time.Time) {
+	if e, ok := p.items[key]; ok {
+		e.primary = deadline.UnixNano()
+		heap.Fix(&p.queue, e.index)
+		return
+	}
+	e := &priorityEntry[K]{key: key, primary: deadline.UnixNano()}
+	p.items[key] = e
+	heap.Push(&p.queue, e)
+}
+
+func (p *TTLPolicy[K]) Inserted(key K) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.setDeadline(key, time.Now().Add(p.TTL))
+}
+
+func (p *TTLPolicy[K]) Accessed(key K) {
+	if !p.RefreshOnAccess {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if _, ok := p.items[key]; ok {
+		p.setDeadline(key, time.Now().Add(p.TTL))
+	}
+}
+
+func (p *TTLPolicy[K]) Removed(key K) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if e, ok := p.items[key]; ok {
+		heap.Remove(&p.queue, e.index)
+		delete(p.items, key)
+	}
+}
+
+func (p *TTLPolicy[K]) Victim(allow func(K) bool) (key K, ok bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if e := p.queue.first(allow); e != nil {
+		return e.key, true
+	}
+	return
+}
+
+func (p *TTLPolicy[K]) Valid(key K, now time.Time) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	e, ok := p.items[key]
+	return !ok || now.UnixNano() < e.primary
+}
+
+// Only entities which expired are visited, so it is cheap to call on every insert.
+func (p *TTLPolicy[K]) Expired(now time.Time) []K {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var a []K
+	n := now.UnixNano()
+	h := &priorityIndices[K]{q: p.queue}
+	if len(p.queue) != 0 {
+		h.indices = []int{0}
+	}
+	for h.Len() != 0 {
+		i := heap.Pop(h).(int)
+		if p.queue[i].primary > n {
+			continue
+		}
+		a = append(a, p.queue[i].key)
+		for _, c := range [2]int{2*i + 1, 2*i + 2} {
+			if c < len(p.queue) {
+				heap.Push(h, c)
+			}
+		}
+	}
+	return a
+}
+
+// Never evicts nor expires entities, so once the cache is full new entities are not inserted.
+type PinPolicy[K comparable] struct{}
+
+func (PinPolicy[K]) Inserted(K) {}
+func (PinPolicy[K]) Accessed(K) {}
+func (PinPolicy[K]) Removed(K)  {}
+
+func (PinPolicy[K]) Victim(func(K) bool) (key K, ok bool) {
+	return
+}
+
+func (PinPolicy[K]) Valid(K, time.Time) bool {
+	return true
+}
+
+func (PinPolicy[K]) Expired(time.Time) []K {
+	return nil
+}
+
+// Wraps Policy so entities for which Pinned returns true are never evicted nor expired,
+// e.g. servers the bot owns.
+type PinnedPolicy[K comparable] struct {
+	Policy EvictionPolicy[K]
+	Pinned func(K) bool
+}
+
+func (p *PinnedPolicy[K]) Inserted(key K) {
+	p.Policy.Inserted(key)
+}
+
+func (p *PinnedPolicy[K]) Accessed(key K) {
+	p.Policy.Accessed(key)
+}
+
+func (p *PinnedPolicy[K]) Removed(key K) {
+	p.Policy.Removed(key)
+}
+
+func (p *PinnedPolicy[K]) Victim(allow func(K) bool) (K, bool) {
+	return p.Policy.Victim(func(k K) bool {
+		return !p.Pinned(k) && (allow == nil || allow(k))
+	})
+}
+
+func (p *PinnedPolicy[K]) Valid(key K, now time.Time) bool {
+	return p.Pinned(key) || p.Policy.Valid(key, now)
+}
+
+func (p *PinnedPolicy[K]) Expired(now time.Time) []K {
+	a := p.Policy.Expired(now)
+	n := 0
+	for _, k := range a {
+		if !p.Pinned(k) {
+			a[n] = k
+			n++
+		}
+	}
+	return a[:n]
+}
@@ -0,0 +1,84 @@
+package regolt
+
+import (
+	"reflect"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestLFUPolicyVictim(t *testing.T) {
+	p := NewLFUPolicy[string]()
+	for _, k := range []string{"a", "b", "c", "d"} {
+		p.Inserted(k)
+	}
+	p.Accessed("a")
+	p.Accessed("a")
+	p.Accessed("b")
+	p.Accessed("c")
+	p.Accessed("c")
+	p.Accessed("c")
+	if k, _ := p.Victim(nil); k != "d" {
+		t.Fatalf("victim: %q", k)
+	}
+	p.Removed("d")
+	// b and a have fewer hits than c, b is allowed
+	if k, _ := p.Victim(func(k string) bool { return k != "b" }); k != "a" {
+		t.Fatalf("victim without b: %q", k)
+	}
+	if _, ok := p.Victim(func(string) bool { return false }); ok {
+		t.Fatal("victim found while nothing is allowed")
+	}
+	p.Removed("b")
+	p.Removed("a")
+	p.Removed("c")
+	if _, ok := p.Victim(nil); ok {
+		t.Fatal("victim found in empty policy")
+	}
+}
+
+func TestTTLPolicyExpired(t *testing.T) {
+	p := NewTTLPolicy[string](time.Hour, true)
+	for _, k := range []string{"a", "b", "c", "d"} {
+		p.Inserted(k)
+	}
+	now := time.Now()
+	if a := p.Expired(now); len(a) != 0 {
+		t.Fatalf("expired before TTL: %v", a)
+	}
+	if k, _ := p.Victim(nil); k != "a" {
+		t.Fatalf("victim: %q", k)
+	}
+	p.Accessed("a")
+	p.Removed("c")
+	if k, _ := p.Victim(nil); k != "b" {
+		t.Fatalf("victim after refreshing a: %q", k)
+	}
+	if k, _ := p.Victim(func(k string) bool { return k == "a" }); k != "a" {
+		t.Fatalf("victim with filter: %q", k)
+	}
+	later := now.Add(2 * time.Hour)
+	if p.Valid("b", later) || !p.Valid("b", now) {
+		t.Fatal("validity of b")
+	}
+	a := p.Expired(later)
+	slices.Sort(a)
+	if !reflect.DeepEqual(a, []string{"a", "b", "d"}) {
+		t.Fatalf("expired after TTL: %v", a)
+	}
+}
+
+func TestCache1TTLExpiry(t *testing.T) {
+	policy := NewTTLPolicy[ULID](time.Hour, false)
+	c := &Cache1[OptimizedUser]{Cache: map[ULID]*OptimizedUser{}, MaxSize: 2, Policy: policy}
+	c.Set(&OptimizedUser{ID: "u1"})
+	c.Set(&OptimizedUser{ID: "u2"})
+	c.Set(&OptimizedUser{ID: "u3"})
+	if keys := sorted(c.Keys()); !reflect.DeepEqual(keys, []ULID{"u2", "u3"}) {
+		t.Fatalf("keys after overflow: %v", keys)
+	}
+	c.expire(time.Now().Add(2 * time.Hour))
+	if keys := c.Keys(); len(keys) != 0 {
+		t.Fatalf("keys after TTL: %v", keys)
+	}
+}
@@ -52,7 +52,7 @@ func main() {
 	if err != nil {
 		panic(err)
 	}
-	socket.Me = u
+	socket.SetSelf(u)
 	plugin := commands.New(api, socket, commands.Config{
 		Commands: []*commands.Command{
 			{
@@ -61,20 +61,15 @@ func main() {
 					ctx.Respond(&regolt.SendMessage{Content: "Pong!"})
 				},
 			},
-			{
-				Name: "calc",
-				Options: []commands.Option{
-					commands.Greedy{Option: commands.UnsignedIntOption{Name: "numbers"}},
-				},
-				Callback: func(ctx *commands.Context) {
-					numbers := ctx.Options["numbers"].([]any)
-					var result uint64
-					for _, number := range numbers {
-						result += number.(uint64)
-					}
-					ctx.Respond(&regolt.SendMessage{Content: fmt.Sprint(result)})
-				},
-			},
+			commands.MustBind(&commands.Command{Name: "calc"}, func(ctx *commands.Context, args *struct {
+				Numbers []uint64 `cmd:"numbers" description:"Numbers to sum up"`
+			}) {
+				var result uint64
+				for _, number := range args.Numbers {
+					result += number
+				}
+				ctx.Respond(&regolt.SendMessage{Content: fmt.Sprint(result)})
+			}),
 			{
 				Name: "about",
 				Options: []commands.Option{
@@ -137,6 +132,9 @@ func main() {
 		},
 		Prefix: "!",
 	})
+	plugin.OnError(func(e *commands.CommandError) {
+		e.Context.Respond(&regolt.SendMessage{Content: e.Err.Error()})
+	})
 	plugin.Install()
 	// uncomment following line if you want make it work only for you
 	// plugin.InstallSelfBot()
@@ -1,6 +1,12 @@
 package regolt
 
-import "net/url"
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"net/url"
+	"strings"
+	"time"
+)
 
 type ULID string
 
@@ -14,3 +20,139 @@ func (id ULID) EncodeFP() string {
 // !             | |
 // !             | | |-- Regolt minor version
 const Version = "1.1.0"
+
+const crockfordAlphabet = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+const ulidLength = 26
+
+// Maps Crockford's base32 characters (including lowercase and ambiguous ones) to their values, 0xFF for invalid ones.
+var crockfordValues = func() (a [256]byte) {
+	for i := range a {
+		a[i] = 0xFF
+	}
+	for i := 0; i < len(crockfordAlphabet); i++ {
+		c := crockfordAlphabet[i]
+		a[c] = byte(i)
+		a[c|0x20] = byte(i)
+	}
+	for _, c := range "Oo" {
+		a[c] = 0
+	}
+	for _, c := range "IiLl" {
+		a[c] = 1
+	}
+	return
+}()
+
+type InvalidULID struct {
+	ID     string
+	Reason string
+}
+
+func (iu InvalidULID) Error() string {
+	return "invalid ULID " + `"` + iu.ID + `": ` + iu.Reason
+}
+
+// Parses ULID, lowercase and ambiguous characters (I, L, O) are accepted and normalized.
+func ParseULID(s string) (ULID, error) {
+	if len(s) != ulidLength {
+		return "", InvalidULID{ID: s, Reason: "must be 26 characters long"}
+	}
+	b := make([]byte, ulidLength)
+	for i := 0; i < len(s); i++ {
+		v := crockfordValues[s[i]]
+		if v == 0xFF {
+			return "", InvalidULID{ID: s, Reason: "invalid character " + `'` + s[i:i+1] + `'`}
+		}
+		b[i] = crockfordAlphabet[v]
+	}
+	// 26 characters hold 130 bits, ULID has only 128
+	if b[0] > '7' {
+		return "", InvalidULID{ID: s, Reason: "overflows 128 bits"}
+	}
+	return ULID(b), nil
+}
+
+// Reports whether id is well-formed ULID in canonical (uppercase) form.
+func (id ULID) Valid() bool {
+	if len(id) != ulidLength || id[0] > '7' {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if v := crockfordValues[id[i]]; v == 0xFF || crockfordAlphabet[v] != id[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Returns time when id was generated, zero time if id is invalid.
+func (id ULID) Time() time.Time {
+	if !id.Valid() {
+		return time.Time{}
+	}
+	var ms int64
+	for i := 0; i < 10; i++ {
+		ms = ms<<5 | int64(crockfordValues[id[i]])
+	}
+	return time.UnixMilli(ms)
+}
+
+// Returns -1 if id was generated before other, 1 if after and 0 if they are equal.
+// IDs are compared lexicographically, so both should be in canonical form.
+func (id ULID) Compare(other ULID) int {
+	return strings.Compare(string(id), string(other))
+}
+
+func (id ULID) Before(other ULID) bool {
+	return id < other
+}
+
+func (id ULID) After(other ULID) bool {
+	return id > other
+}
+
+// Returns the first 10 characters of ULIDs generated at t. ULIDs are lexicographically sortable,
+// so IDs less than the prefix were generated before t.
+func ulidTimePrefix(t time.Time) string {
+	ms := uint64(t.UnixMilli())
+	b := make([]byte, 10)
+	for i := 9; i >= 0; i-- {
+		b[i] = crockfordAlphabet[ms&31]
+		ms >>= 5
+	}
+	return string(b)
+}
+
+// Returns the smallest ULID generated at t, meant to be used as Before/After cursor, e.g.
+// `FetchMessages{After: regolt.ULIDFromTime(time.Now().Add(-24 * time.Hour))}` for messages from the last 24 hours.
+func ULIDFromTime(t time.Time) ULID {
+	return ULID(ulidTimePrefix(t) + "0000000000000000")
+}
+
+// Generates ULID at t with random entropy.
+func NewULIDAt(t time.Time) ULID {
+	var r [10]byte
+	if _, err := rand.Read(r[:]); err != nil {
+		panic("regolt: failed to read random bytes: " + err.Error())
+	}
+	hi, lo := uint64(binary.BigEndian.Uint16(r[:2])), binary.BigEndian.Uint64(r[2:])
+	b := []byte(ulidTimePrefix(t) + "0000000000000000")
+	// 80 bits of entropy: 16 characters, 5 bits each
+	for i := ulidLength - 1; i >= 10; i-- {
+		b[i] = crockfordAlphabet[lo&31]
+		lo = lo>>5 | (hi&31)<<59
+		hi >>= 5
+	}
+	return ULID(b)
+}
+
+// Generates new ULID, it can be used as message nonce or idempotency key.
+func NewULID() ULID {
+	return NewULIDAt(time.Now())
+}
+
+// Generates nonce for SendMessage. Revolt rejects messages with duplicate nonces, so it guards against double sends on retries.
+func NewNonce() string {
+	return string(NewULID())
+}
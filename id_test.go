@@ -0,0 +1,107 @@
+package regolt
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// Example from ULID reference implementation.
+const (
+	specULID     ULID  = "01ARYZ6S41TSV4RRFFQ69G5FAV"
+	specULIDTime int64 = 1469918176385
+)
+
+func TestParseULID(t *testing.T) {
+	for _, c := range []struct {
+		in   string
+		want ULID
+		ok   bool
+	}{
+		{"01ARYZ6S41TSV4RRFFQ69G5FAV", specULID, true},
+		{"01aryz6s41tsv4rrffq69g5fav", specULID, true},
+		{"oIArYZ6S4lTSV4RRFFQ69G5FAV", specULID, true},
+		{"OLARYZ6S4ITSV4RRFFQ69G5FAV", specULID, true},
+		{"7ZZZZZZZZZZZZZZZZZZZZZZZZZ", "7ZZZZZZZZZZZZZZZZZZZZZZZZZ", true},
+		{"00000000000000000000000000", "00000000000000000000000000", true},
+		// overflows 128 bits
+		{"80000000000000000000000000", "", false},
+		{"ZZZZZZZZZZZZZZZZZZZZZZZZZZ", "", false},
+		// U isn't in the alphabet
+		{"01ARYZ6S41TSV4RRFFQ69G5FAU", "", false},
+		{"01ARYZ6S41TSV4RRFFQ69G5FA-", "", false},
+		{"01ARYZ6S41TSV4RRFFQ69G5FA", "", false},
+		{"01ARYZ6S41TSV4RRFFQ69G5FAVV", "", false},
+		{"", "", false},
+	} {
+		got, err := ParseULID(c.in)
+		if c.ok != (err == nil) || got != c.want {
+			t.Errorf("ParseULID(%q) = %q, %v; want %q", c.in, got, err, c.want)
+		}
+		var iu InvalidULID
+		if err != nil && (!errors.As(err, &iu) || iu.ID != c.in) {
+			t.Errorf("ParseULID(%q) returned %T %v", c.in, err, err)
+		}
+	}
+}
+
+func TestULIDValid(t *testing.T) {
+	for id, want := range map[ULID]bool{
+		specULID:                     true,
+		"7ZZZZZZZZZZZZZZZZZZZZZZZZZ": true,
+		// not canonical
+		"01aryz6s41tsv4rrffq69g5fav": false,
+		"O1ARYZ6S41TSV4RRFFQ69G5FAV": false,
+		"01ARYZ6S41TSV4RRFFQ69G5FAI": false,
+		"80000000000000000000000000": false,
+		"01ARYZ6S41TSV4RRFFQ69G5FA":  false,
+		"":                           false,
+	} {
+		if got := id.Valid(); got != want {
+			t.Errorf("%q.Valid() = %v", id, got)
+		}
+	}
+}
+
+func TestULIDTime(t *testing.T) {
+	if got := specULID.Time(); got.UnixMilli() != specULIDTime {
+		t.Fatalf("time of %s: %d, want %d", specULID, got.UnixMilli(), specULIDTime)
+	}
+	if got := ULID("invalid").Time(); !got.IsZero() {
+		t.Fatalf("time of invalid ULID: %v", got)
+	}
+	at := time.UnixMilli(specULIDTime)
+	if got := ULIDFromTime(at); got != "01ARYZ6S410000000000000000" {
+		t.Fatalf("ULIDFromTime: %s", got)
+	}
+	if !ULIDFromTime(at).Before(specULID) || !ULIDFromTime(at.Add(time.Millisecond)).After(specULID) {
+		t.Fatal("ULIDFromTime isn't usable as cursor")
+	}
+	for i := 0; i < 100; i++ {
+		id := NewULIDAt(at)
+		if !id.Valid() || id[:10] != specULID[:10] || !id.Time().Equal(at) {
+			t.Fatalf("NewULIDAt: %s", id)
+		}
+	}
+	if NewULIDAt(at) == NewULIDAt(at) {
+		t.Fatal("NewULIDAt generated the same ULID twice")
+	}
+}
+
+func TestNewULID(t *testing.T) {
+	before := time.Now().Truncate(time.Millisecond)
+	id := NewULID()
+	after := time.Now()
+	if !id.Valid() {
+		t.Fatalf("NewULID generated invalid ULID %q", id)
+	}
+	if parsed, err := ParseULID(string(id)); err != nil || parsed != id {
+		t.Fatalf("ParseULID(%q) = %q, %v", id, parsed, err)
+	}
+	if tm := id.Time(); tm.Before(before) || tm.After(after) {
+		t.Fatalf("time of %s is %v, generated between %v and %v", id, tm, before, after)
+	}
+	if next := NewULIDAt(after.Add(time.Millisecond)); id.Compare(next) != -1 || next.Compare(id) != 1 || id.Compare(id) != 0 {
+		t.Fatalf("%s and %s are ordered wrong", id, next)
+	}
+}
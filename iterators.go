@@ -0,0 +1,262 @@
+package regolt
+
+import "time"
+
+type page[T any] struct {
+	items   []T
+	users   []*User
+	members []*Member
+	// whether there may be next page
+	more bool
+}
+
+// Iterator walks over paginated results, fetching next page when the current one is exhausted.
+// Requests go through API, so rate limits are respected.
+// Example:
+//
+//	it := api.IterateMessages(channel, nil)
+//	for it.Next() {
+//		m := it.Value()
+//	}
+//	if err := it.Err(); err != nil {
+//		...
+//	}
+type Iterator[T any] struct {
+	fetch   func() (*page[T], error)
+	items   []T
+	pos     int
+	more    bool
+	current T
+	err     error
+	users   map[ULID]*User
+	members map[ULID]*Member
+	// reports whether iteration must stop before v
+	stop  func(v T) bool
+	max   int
+	count int
+}
+
+func newIterator[T any](fetch func() (*page[T], error)) *Iterator[T] {
+	return &Iterator[T]{fetch: fetch, more: true}
+}
+
+// Advances iterator, returns false when there are no more values or an error occurred.
+func (it *Iterator[T]) Next() bool {
+	if it.err != nil || (it.max > 0 && it.count >= it.max) {
+		return false
+	}
+	for it.pos >= len(it.items) {
+		if !it.more {
+			return false
+		}
+		p, err := it.fetch()
+		if err != nil {
+			it.err = err
+			return false
+		}
+		it.items, it.pos, it.more = p.items, 0, p.more && len(p.items) != 0
+		it.users = make(map[ULID]*User, len(p.users))
+		for _, u := range p.users {
+			it.users[u.ID] = u
+		}
+		it.members = make(map[ULID]*Member, len(p.members))
+		for _, m := range p.members {
+			it.members[m.ID.User] = m
+		}
+	}
+	v := it.items[it.pos]
+	if it.stop != nil && it.stop(v) {
+		it.items, it.more = nil, false
+		return false
+	}
+	it.pos++
+	it.count++
+	it.current = v
+	return true
+}
+
+// Returns value Next advanced to.
+func (it *Iterator[T]) Value() T {
+	return it.current
+}
+
+// Returns error which stopped iteration, if any.
+func (it *Iterator[T]) Err() error {
+	return it.err
+}
+
+// Returns user fetched along with the current page, nil if there is no such user or users weren't requested.
+func (it *Iterator[T]) User(id ULID) *User {
+	return it.users[id]
+}
+
+// Returns member fetched along with the current page, nil if there is no such member or members weren't requested.
+func (it *Iterator[T]) Member(user ULID) *Member {
+	return it.members[user]
+}
+
+// Collects remaining values.
+func (it *Iterator[T]) All() ([]T, error) {
+	var a []T
+	for it.Next() {
+		a = append(a, it.Value())
+	}
+	return a, it.Err()
+}
+
+type IterateMessages struct {
+	// MessageSortByLatest (default) walks from the newest message to the oldest one, MessageSortByOldest in the opposite direction
+	Sort MessageSort
+	// Iteration starts after this message, empty to start from the newest (or oldest) message
+	Start ULID
+	// Iteration stops when this message is reached, the message isn't included
+	StopAt ULID
+	// Iteration stops at messages sent before this time (or after, if walking from the oldest message)
+	StopTime time.Time
+	// Count of messages fetched per request, defaults to 100
+	PageSize int
+	// Maximum count of messages to iterate over, 0 for no limit
+	Max int
+	// Whether to fetch users and members, available through Iterator.User and Iterator.Member
+	IncludeUsers bool
+}
+
+func (o *IterateMessages) stop() func(*Message) bool {
+	forward := o.Sort == MessageSortByOldest
+	prefix := ""
+	if !o.StopTime.IsZero() {
+		prefix = ulidTimePrefix(o.StopTime)
+	}
+	if len(o.StopAt) == 0 && len(prefix) == 0 {
+		return nil
+	}
+	return func(m *Message) bool {
+		if forward {
+			return (len(o.StopAt) != 0 && m.ID >= o.StopAt) || (len(prefix) != 0 && string(m.ID) >= prefix)
+		}
+		return (len(o.StopAt) != 0 && m.ID <= o.StopAt) || (len(prefix) != 0 && string(m.ID) < prefix)
+	}
+}
+
+func iterateMessages(options *IterateMessages, fetch func(before, after ULID, sort MessageSort, limit int) (*Messages, error)) *Iterator[*Message] {
+	o := IterateMessages{}
+	if options != nil {
+		o = *options
+	}
+	if o.Sort != MessageSortByOldest {
+		o.Sort = MessageSortByLatest
+	}
+	if o.PageSize <= 0 || o.PageSize > 100 {
+		o.PageSize = 100
+	}
+	cursor := o.Start
+	it := newIterator(func() (*page[*Message], error) {
+		var before, after ULID
+		if o.Sort == MessageSortByOldest {
+			after = cursor
+		} else {
+			before = cursor
+		}
+		m, err := fetch(before, after, o.Sort, o.PageSize)
+		if err != nil {
+			return nil, err
+		}
+		if len(m.Messages) != 0 {
+			cursor = m.Messages[len(m.Messages)-1].ID
+		}
+		return &page[*Message]{
+			items:   m.Messages,
+			users:   m.Users,
+			members: m.Members,
+			more:    len(m.Messages) >= o.PageSize,
+		}, nil
+	})
+	it.stop = o.stop()
+	it.max = o.Max
+	return it
+}
+
+// Walks over messages in channel.
+func (api *API) IterateMessages(channel ULID, options *IterateMessages) *Iterator[*Message] {
+	includeUsers := options != nil && options.IncludeUsers
+	return iterateMessages(options, func(before, after ULID, sort MessageSort, limit int) (*Messages, error) {
+		return api.FetchMessages(channel, &FetchMessages{
+			Limit:        limit,
+			Before:       before,
+			After:        after,
+			Sort:         sort,
+			IncludeUsers: &includeUsers,
+		})
+	})
+}
+
+// Walks over messages matching filter globally, this is a privileged route.
+// Before, After, Sort, Nearby, Limit and IncludeUsers of filter are ignored, options are used instead.
+func (api *API) IterateGlobalMessages(filter *GloballyFetchMessages, options *IterateMessages) *Iterator[*Message] {
+	f := GloballyFetchMessages{}
+	if filter != nil {
+		f = *filter
+	}
+	f.Nearby = ""
+	f.IncludeUsers = options != nil && options.IncludeUsers
+	return iterateMessages(options, func(before, after ULID, sort MessageSort, limit int) (*Messages, error) {
+		p := f
+		p.Before, p.After, p.Sort, p.Limit = before, after, sort, limit
+		return api.GloballyFetchMessages(&p)
+	})
+}
+
+// Walks over server members, users are available through Iterator.User.
+// Revolt returns all members at once, so only one request is made.
+func (api *API) IterateMembers(server ULID, params *FetchMembers) *Iterator[*Member] {
+	return newIterator(func() (*page[*Member], error) {
+		r, err := api.FetchMembers(server, params)
+		if err != nil {
+			return nil, err
+		}
+		p := &page[*Member]{
+			items: make([]*Member, len(r.Members)),
+			users: make([]*User, len(r.Users)),
+		}
+		for i := range r.Members {
+			p.items[i] = &r.Members[i]
+		}
+		for i := range r.Users {
+			p.users[i] = &r.Users[i]
+		}
+		return p, nil
+	})
+}
+
+// Walks over server bans, banned users are available through Iterator.User.
+// Revolt returns all bans at once, so only one request is made.
+func (api *API) IterateBans(server ULID) *Iterator[*Ban] {
+	return newIterator(func() (*page[*Ban], error) {
+		r, err := api.FetchBans(server)
+		if err != nil {
+			return nil, err
+		}
+		p := &page[*Ban]{
+			items: make([]*Ban, len(r.Bans)),
+			users: make([]*User, len(r.Users)),
+		}
+		for i := range r.Bans {
+			p.items[i] = &r.Bans[i]
+		}
+		for i := range r.Users {
+			p.users[i] = &r.Users[i]
+		}
+		return p, nil
+	})
+}
+
+// Walks over reports. Revolt returns all reports at once, so only one request is made.
+func (api *API) IterateReports(params *FetchReports) *Iterator[*Report] {
+	return newIterator(func() (*page[*Report], error) {
+		a, err := api.FetchReports(params)
+		if err != nil {
+			return nil, err
+		}
+		return &page[*Report]{items: a}, nil
+	})
+}
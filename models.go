@@ -553,7 +553,7 @@ const (
 	PermissionManagePermissions
 	PermissionManageRoles
 	PermissionManageCustomisation
-	PermissionKickMembers Permissions = 1 << (6 + iota)
+	PermissionKickMembers Permissions = 1 << (1 + iota)
 	PermissionBanMembers
 	PermissionTimeoutMembers
 	PermissionAssignRoles
@@ -561,7 +561,7 @@ const (
 	PermissionManageNicknames
 	PermissionChangeAvatar
 	PermissionRemoveAvatars
-	PermissionViewChannel Permissions = 1 << (20 + iota)
+	PermissionViewChannel Permissions = 1 << (7 + iota)
 	PermissionReadMessageHistory
 	PermissionSendMessages
 	PermissionManageMessages
@@ -605,8 +605,8 @@ type Channel struct {
 	Recipients []ULID `json:"recipients,omitempty"`
 	// ID of the last message sent in this channel
 	LastMessageID ULID `json:"last_message_id,omitempty"`
-	// Permissions assigned to members of this group (does not apply to the owner of the group)
-	Permissions Permissions `json:"permissions,omitempty"`
+	// Permissions assigned to members of this group (does not apply to the owner of the group), nil if not set
+	Permissions *Permissions `json:"permissions,omitempty"`
 	// Representation of a single permission override as it appears on models and in the database
 	DefaultPermissions *PermissionOverride `json:"default_permissions,omitempty"`
 	// Permissions assigned based on role to this channel
@@ -675,8 +675,8 @@ type OptimizedChannel struct {
 	Recipients []ULID
 	// ID of the last message sent in this channel
 	LastMessageID ULID
-	// Permissions assigned to members of this group (does not apply to the owner of the group)
-	Permissions Permissions
+	// Permissions assigned to members of this group (does not apply to the owner of the group), nil if not set
+	Permissions *Permissions
 	// Representation of a single permission override as it appears on models and in the database
 	DefaultPermissions *PermissionOverride
 	// Permissions assigned based on role to this channel
@@ -0,0 +1,364 @@
+package regolt
+
+import (
+	"encoding/json"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// All permissions which can be granted.
+	PermissionGrantAllSafe Permissions = 0x000F_FFFF_FFFF_FFFF
+	// Permissions which timed out members keep.
+	PermissionsAllowInTimeout  = PermissionViewChannel | PermissionReadMessageHistory
+	PermissionsDefaultViewOnly = PermissionViewChannel | PermissionReadMessageHistory
+	PermissionsDefault         = PermissionsDefaultViewOnly | PermissionSendMessages | PermissionInviteOthers |
+		PermissionSendEmbeds | PermissionUploadFiles | PermissionConnect | PermissionSpeak
+	PermissionsDefaultDirectMessage = PermissionsDefault | PermissionReact | PermissionManageChannel
+	PermissionsDefaultServer        = PermissionsDefault | PermissionReact | PermissionChangeNickname | PermissionChangeAvatar
+	// All permissions which apply to server as a whole.
+	PermissionsAllServer = PermissionManageServer | PermissionManagePermissions | PermissionManageRoles |
+		PermissionManageCustomisation | PermissionKickMembers | PermissionBanMembers | PermissionTimeoutMembers |
+		PermissionAssignRoles | PermissionChangeNickname | PermissionManageNicknames | PermissionChangeAvatar |
+		PermissionRemoveAvatars
+	// All permissions which can be overridden in channel.
+	PermissionsAllChannel = PermissionManageChannel | PermissionManagePermissions | PermissionViewChannel |
+		PermissionReadMessageHistory | PermissionSendMessages | PermissionManageMessages | PermissionManageWebhooks |
+		PermissionInviteOthers | PermissionSendEmbeds | PermissionUploadFiles | PermissionMasquerade | PermissionReact |
+		PermissionConnect | PermissionSpeak | PermissionVideo | PermissionMuteMembers | PermissionDeafenMembers |
+		PermissionMoveMembers
+	// All named permissions.
+	PermissionsAll = PermissionsAllServer | PermissionsAllChannel
+)
+
+type permissionName struct {
+	name  string
+	value Permissions
+}
+
+// Ordered by bit.
+var permissionNames = []permissionName{
+	{"ManageChannel", PermissionManageChannel},
+	{"ManageServer", PermissionManageServer},
+	{"ManagePermissions", PermissionManagePermissions},
+	{"ManageRoles", PermissionManageRoles},
+	{"ManageCustomisation", PermissionManageCustomisation},
+	{"KickMembers", PermissionKickMembers},
+	{"BanMembers", PermissionBanMembers},
+	{"TimeoutMembers", PermissionTimeoutMembers},
+	{"AssignRoles", PermissionAssignRoles},
+	{"ChangeNickname", PermissionChangeNickname},
+	{"ManageNicknames", PermissionManageNicknames},
+	{"ChangeAvatar", PermissionChangeAvatar},
+	{"RemoveAvatars", PermissionRemoveAvatars},
+	{"ViewChannel", PermissionViewChannel},
+	{"ReadMessageHistory", PermissionReadMessageHistory},
+	{"SendMessages", PermissionSendMessages},
+	{"ManageMessages", PermissionManageMessages},
+	{"ManageWebhooks", PermissionManageWebhooks},
+	{"InviteOthers", PermissionInviteOthers},
+	{"SendEmbeds", PermissionSendEmbeds},
+	{"UploadFiles", PermissionUploadFiles},
+	{"Masquerade", PermissionMasquerade},
+	{"React", PermissionReact},
+	{"Connect", PermissionConnect},
+	{"Speak", PermissionSpeak},
+	{"Video", PermissionVideo},
+	{"MuteMembers", PermissionMuteMembers},
+	{"DeafenMembers", PermissionDeafenMembers},
+	{"MoveMembers", PermissionMoveMembers},
+}
+
+type UnknownPermission struct {
+	Name string
+}
+
+func (up UnknownPermission) Error() string {
+	return "unknown permission: " + up.Name
+}
+
+// Reports whether p contains all permissions in q.
+func (p Permissions) Has(q Permissions) bool {
+	return p&q == q
+}
+
+// Reports whether p contains at least one permission in q.
+func (p Permissions) HasAny(q Permissions) bool {
+	return p&q != 0
+}
+
+func (p Permissions) Add(q Permissions) Permissions {
+	return p | q
+}
+
+func (p Permissions) Remove(q Permissions) Permissions {
+	return p &^ q
+}
+
+// Returns permissions which are in q, but not in p, and ones which are in p, but not in q.
+func (p Permissions) Diff(q Permissions) (added, removed Permissions) {
+	return q &^ p, p &^ q
+}
+
+// Returns names of permissions in p. Unnamed bits are ignored.
+func (p Permissions) Names() []string {
+	var a []string
+	for _, n := range permissionNames {
+		if p&n.value != 0 {
+			a = append(a, n.name)
+		}
+	}
+	return a
+}
+
+// Formats permissions like `SendMessages|ManageRoles`. Unnamed bits are appended as hexadecimal number,
+// empty set is formatted as `0`.
+func (p Permissions) String() string {
+	if p == 0 {
+		return "0"
+	}
+	a := p.Names()
+	if r := p &^ PermissionsAll; r != 0 {
+		a = append(a, "0x"+strconv.FormatUint(uint64(r), 16))
+	}
+	return strings.Join(a, "|")
+}
+
+// Parses permissions formatted by Permissions.String. Names are case insensitive and may be separated by `|` or `,`,
+// numbers are accepted as well.
+func ParsePermissions(s string) (p Permissions, err error) {
+	for _, f := range strings.FieldsFunc(s, func(r rune) bool { return r == '|' || r == ',' }) {
+		f = strings.TrimSpace(f)
+		if len(f) == 0 {
+			continue
+		}
+		if n, err := strconv.ParseInt(f, 0, 64); err == nil {
+			p |= Permissions(n)
+			continue
+		}
+		// unnamed bits with the highest bit set are formatted as unsigned
+		if n, err := strconv.ParseUint(f, 0, 64); err == nil {
+			p |= Permissions(n)
+			continue
+		}
+		i := slices.IndexFunc(permissionNames, func(n permissionName) bool {
+			return strings.EqualFold(n.name, f)
+		})
+		if i < 0 {
+			return 0, UnknownPermission{Name: f}
+		}
+		p |= permissionNames[i].value
+	}
+	return
+}
+
+// Permissions are sent as number.
+func (p Permissions) MarshalJSON() ([]byte, error) {
+	return strconv.AppendInt(nil, int64(p), 10), nil
+}
+
+// Accepts number or string in format of ParsePermissions, so permissions can be written by name in config files.
+func (p *Permissions) UnmarshalJSON(d []byte) error {
+	if len(d) != 0 && d[0] == '"' {
+		var s string
+		if err := json.Unmarshal(d, &s); err != nil {
+			return err
+		}
+		r, err := ParsePermissions(s)
+		if err != nil {
+			return err
+		}
+		*p = r
+		return nil
+	}
+	var n int64
+	if err := json.Unmarshal(d, &n); err != nil {
+		return err
+	}
+	*p = Permissions(n)
+	return nil
+}
+
+// Returns p with o applied.
+func (o PermissionOverride) Apply(p Permissions) Permissions {
+	return (p | o.Allow) & ^o.Disallow
+}
+
+// Returns changes between o and n, e.g. between cached role and ServerRoleUpdate data.
+func (o PermissionOverride) Diff(n PermissionOverride) (allowAdded, allowRemoved, disallowAdded, disallowRemoved Permissions) {
+	allowAdded, allowRemoved = o.Allow.Diff(n.Allow)
+	disallowAdded, disallowRemoved = o.Disallow.Diff(n.Disallow)
+	return
+}
+
+func (o PermissionOverride) String() string {
+	return "+(" + o.Allow.String() + ") -(" + o.Disallow.String() + ")"
+}
+
+type PermissionsQuery struct {
+	// User whose permissions are computed
+	User ULID
+	// Server the channel belongs to, nil for channels outside of servers
+	Server *OptimizedServer
+	// Roles of the server, roles member doesn't have are ignored
+	Roles map[ULID]*OptimizedRole
+	// Member object of the user, nil if user isn't member of the server
+	Member *Member
+	// Channel to compute permissions in, nil for server-wide permissions
+	Channel *OptimizedChannel
+	// Used to check whether member is timed out, defaults to current time
+	Now time.Time
+}
+
+// Returns member's roles ordered from least to most important, so they can be applied in order.
+func (q *PermissionsQuery) memberRoles() []*OptimizedRole {
+	if q.Member == nil {
+		return nil
+	}
+	a := make([]*OptimizedRole, 0, len(q.Member.Roles))
+	for _, id := range q.Member.Roles {
+		if r, ok := q.Roles[id]; ok && r != nil {
+			a = append(a, r)
+		}
+	}
+	// lower rank means higher priority
+	slices.SortStableFunc(a, func(x, y *OptimizedRole) int {
+		return y.Rank - x.Rank
+	})
+	return a
+}
+
+func (q *PermissionsQuery) timedOut() bool {
+	if q.Member == nil || q.Member.Timeout == nil {
+		return false
+	}
+	now := q.Now
+	if now.IsZero() {
+		now = time.Now()
+	}
+	return time.Time(*q.Member.Timeout).After(now)
+}
+
+func (q *PermissionsQuery) serverPermissions() Permissions {
+	if q.Server.Owner == q.User {
+		return PermissionGrantAllSafe
+	}
+	if q.Member == nil {
+		return 0
+	}
+	p := q.Server.DefaultPermissions
+	for _, r := range q.memberRoles() {
+		p = r.Permissions.Apply(p)
+	}
+	if q.timedOut() {
+		p &= PermissionsAllowInTimeout
+	}
+	return p
+}
+
+// Computes effective permissions of user following Revolt's algorithm.
+func ComputePermissions(q *PermissionsQuery) Permissions {
+	c := q.Channel
+	if c == nil {
+		if q.Server == nil {
+			return 0
+		}
+		return q.serverPermissions()
+	}
+	switch c.Type {
+	case OptimizedChannelTypeSavedMessages:
+		if c.User == q.User {
+			return PermissionGrantAllSafe
+		}
+		return 0
+	case OptimizedChannelTypeDirectMessage:
+		if slices.Contains(c.Recipients, q.User) {
+			return PermissionsDefaultDirectMessage
+		}
+		return 0
+	case OptimizedChannelTypeGroup:
+		if c.Owner == q.User {
+			return PermissionGrantAllSafe
+		}
+		if slices.Contains(c.Recipients, q.User) {
+			// explicitly set empty permissions don't fall back to defaults
+			if c.Permissions != nil {
+				return *c.Permissions
+			}
+			return PermissionsDefaultDirectMessage
+		}
+		return 0
+	case OptimizedChannelTypeTextChannel, OptimizedChannelTypeVoiceChannel:
+		if q.Server == nil {
+			return 0
+		}
+		if q.Server.Owner == q.User {
+			return PermissionGrantAllSafe
+		}
+		if q.Member == nil {
+			return 0
+		}
+		p := q.serverPermissions()
+		if c.DefaultPermissions != nil {
+			p = c.DefaultPermissions.Apply(p)
+		}
+		for _, r := range q.memberRoles() {
+			if o, ok := c.RolePermissions[r.ID]; ok {
+				p = o.Apply(p)
+			}
+		}
+		if q.timedOut() {
+			p &= PermissionsAllowInTimeout
+		}
+		if p&PermissionViewChannel == 0 {
+			return 0
+		}
+		return p
+	default:
+		return 0
+	}
+}
+
+// Same as ComputePermissions, but takes raw models. server, member and channel can be nil.
+func ComputeRawPermissions(user ULID, server *Server, member *Member, channel *Channel) Permissions {
+	q := &PermissionsQuery{User: user, Member: member}
+	if server != nil {
+		q.Server = server.ToOptimized()
+		q.Roles = make(map[ULID]*OptimizedRole, len(server.Roles))
+		for i, r := range server.Roles {
+			q.Roles[i] = r.ToOptimized(i)
+		}
+	}
+	if channel != nil {
+		q.Channel = channel.ToOptimized()
+	}
+	return ComputePermissions(q)
+}
+
+// Computes permissions of user from cached entities. If channel is empty, server-wide permissions
+// are returned, otherwise server is taken from the channel. Missing entities are treated as absent,
+// so result may be incomplete if cache doesn't hold them.
+func (gc *GenericCache) ComputePermissions(user, server, channel ULID) Permissions {
+	q := &PermissionsQuery{User: user}
+	if len(channel) != 0 {
+		q.Channel = gc.Channels.Get(channel)
+		if q.Channel == nil {
+			return 0
+		}
+		if len(q.Channel.Server) != 0 {
+			server = q.Channel.Server
+		}
+	}
+	if len(server) != 0 {
+		q.Server = gc.Servers.Get(server)
+		q.Member = gc.Members.Get(server, user)
+		roles := gc.Roles.Values(server)
+		q.Roles = make(map[ULID]*OptimizedRole, len(roles))
+		for _, r := range roles {
+			q.Roles[r.ID] = r
+		}
+	}
+	return ComputePermissions(q)
+}
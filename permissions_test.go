@@ -0,0 +1,262 @@
+package regolt
+
+import (
+	"encoding/json"
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestComputePermissions(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	future := Time(now.Add(time.Hour))
+	past := Time(now.Add(-time.Hour))
+	empty := Permissions(0)
+	groupPermissions := PermissionViewChannel | PermissionSendMessages
+
+	server := &OptimizedServer{ID: "s1", Owner: "owner", DefaultPermissions: PermissionsDefaultServer}
+	roles := map[ULID]*OptimizedRole{
+		// lower rank has higher priority
+		"high": {ID: "high", Rank: 1, Permissions: PermissionOverride{Allow: PermissionManageMessages | PermissionSendMessages}},
+		"low":  {ID: "low", Rank: 2, Permissions: PermissionOverride{Allow: PermissionKickMembers, Disallow: PermissionSendMessages | PermissionManageMessages}},
+	}
+	text := &OptimizedChannel{ID: "c1", Type: OptimizedChannelTypeTextChannel, Server: "s1"}
+	member := func(timeout *Time, roles ...ULID) *Member {
+		return &Member{ID: MemberID{Server: "s1", User: "user"}, Roles: roles, Timeout: timeout}
+	}
+
+	tests := []struct {
+		name    string
+		user    ULID
+		member  *Member
+		channel *OptimizedChannel
+		noRoles bool
+		want    Permissions
+	}{
+		{name: "server owner", user: "owner", want: PermissionGrantAllSafe},
+		{name: "server owner in channel", user: "owner", channel: &OptimizedChannel{
+			Type: OptimizedChannelTypeTextChannel, Server: "s1",
+			DefaultPermissions: &PermissionOverride{Disallow: PermissionViewChannel},
+		}, want: PermissionGrantAllSafe},
+		{name: "non-member", user: "user", want: 0},
+		{name: "non-member in channel", user: "user", channel: text, want: 0},
+		{name: "member defaults", user: "user", member: member(nil), want: PermissionsDefaultServer},
+		{name: "member defaults in channel", user: "user", member: member(nil), channel: text, want: PermissionsDefaultServer},
+		{
+			name: "higher ranked role wins", user: "user", member: member(nil, "low", "high"),
+			want: PermissionsDefaultServer | PermissionKickMembers | PermissionManageMessages,
+		},
+		{
+			name: "lower ranked role only", user: "user", member: member(nil, "low"),
+			want: (PermissionsDefaultServer | PermissionKickMembers) &^ PermissionSendMessages,
+		},
+		{name: "unknown roles are ignored", user: "user", member: member(nil, "low", "high"), noRoles: true, want: PermissionsDefaultServer},
+		{
+			name: "channel default override", user: "user", member: member(nil),
+			channel: &OptimizedChannel{
+				Type: OptimizedChannelTypeTextChannel, Server: "s1",
+				DefaultPermissions: &PermissionOverride{Allow: PermissionManageWebhooks, Disallow: PermissionSendMessages},
+			},
+			want: (PermissionsDefaultServer | PermissionManageWebhooks) &^ PermissionSendMessages,
+		},
+		{
+			name: "role override applies after channel default", user: "user", member: member(nil, "high"),
+			channel: &OptimizedChannel{
+				Type: OptimizedChannelTypeTextChannel, Server: "s1",
+				DefaultPermissions: &PermissionOverride{Disallow: PermissionSendMessages | PermissionUploadFiles},
+				RolePermissions:    map[ULID]PermissionOverride{"high": {Allow: PermissionSendMessages}},
+			},
+			want: (PermissionsDefaultServer | PermissionManageMessages) &^ PermissionUploadFiles,
+		},
+		{
+			name: "role overrides apply by rank", user: "user", member: member(nil, "high", "low"),
+			channel: &OptimizedChannel{
+				Type: OptimizedChannelTypeVoiceChannel, Server: "s1",
+				RolePermissions: map[ULID]PermissionOverride{
+					"high": {Allow: PermissionSpeak},
+					"low":  {Disallow: PermissionSpeak | PermissionConnect},
+				},
+			},
+			want: (PermissionsDefaultServer | PermissionKickMembers | PermissionManageMessages) &^ PermissionConnect,
+		},
+		{
+			name: "view channel revoked", user: "user", member: member(nil, "high"),
+			channel: &OptimizedChannel{
+				Type: OptimizedChannelTypeTextChannel, Server: "s1",
+				DefaultPermissions: &PermissionOverride{Disallow: PermissionViewChannel},
+			},
+			want: 0,
+		},
+		{name: "timed out", user: "user", member: member(&future, "high"), want: PermissionsAllowInTimeout},
+		{name: "timed out in channel", user: "user", member: member(&future, "high"), channel: text, want: PermissionsAllowInTimeout},
+		{
+			name: "timeout is over", user: "user", member: member(&past, "high"),
+			want: PermissionsDefaultServer | PermissionManageMessages,
+		},
+		{name: "saved messages of user", user: "user", channel: &OptimizedChannel{Type: OptimizedChannelTypeSavedMessages, User: "user"}, want: PermissionGrantAllSafe},
+		{name: "saved messages of other", user: "user", channel: &OptimizedChannel{Type: OptimizedChannelTypeSavedMessages, User: "other"}, want: 0},
+		{name: "direct message recipient", user: "user", channel: &OptimizedChannel{Type: OptimizedChannelTypeDirectMessage, Recipients: []ULID{"user", "other"}}, want: PermissionsDefaultDirectMessage},
+		{name: "direct message outsider", user: "user", channel: &OptimizedChannel{Type: OptimizedChannelTypeDirectMessage, Recipients: []ULID{"a", "b"}}, want: 0},
+		{name: "group owner", user: "user", channel: &OptimizedChannel{Type: OptimizedChannelTypeGroup, Owner: "user", Permissions: &empty}, want: PermissionGrantAllSafe},
+		{name: "group recipient with defaults", user: "user", channel: &OptimizedChannel{Type: OptimizedChannelTypeGroup, Owner: "other", Recipients: []ULID{"user", "other"}}, want: PermissionsDefaultDirectMessage},
+		{name: "group recipient with permissions", user: "user", channel: &OptimizedChannel{Type: OptimizedChannelTypeGroup, Owner: "other", Recipients: []ULID{"user"}, Permissions: &groupPermissions}, want: groupPermissions},
+		{name: "group recipient with empty permissions", user: "user", channel: &OptimizedChannel{Type: OptimizedChannelTypeGroup, Owner: "other", Recipients: []ULID{"user"}, Permissions: &empty}, want: 0},
+		{name: "group outsider", user: "user", channel: &OptimizedChannel{Type: OptimizedChannelTypeGroup, Owner: "other", Recipients: []ULID{"other"}}, want: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := &PermissionsQuery{User: tt.user, Member: tt.member, Channel: tt.channel, Now: now}
+			if tt.channel == nil || len(tt.channel.Server) != 0 {
+				q.Server = server
+				q.Roles = roles
+				if tt.noRoles {
+					q.Roles = nil
+				}
+			}
+			if got := ComputePermissions(q); got != tt.want {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestComputeRawPermissionsGroup(t *testing.T) {
+	var c *Channel
+	if err := arshalUnmarshal(nil, []byte(`{"channel_type":"Group","_id":"g1","name":"g","owner":"o","recipients":["o","u"],"permissions":0}`), &c); err != nil {
+		t.Fatal(err)
+	}
+	if got := ComputeRawPermissions("u", nil, nil, c); got != 0 {
+		t.Fatalf("explicit empty group permissions: %v", got)
+	}
+	c.Permissions = nil
+	if got := ComputeRawPermissions("u", nil, nil, c); got != PermissionsDefaultDirectMessage {
+		t.Fatalf("group without permissions: %v", got)
+	}
+}
+
+// Bits as defined by Revolt, see https://developers.revolt.chat/developers/api/permissions.html.
+func TestPermissionBits(t *testing.T) {
+	tests := []struct {
+		p   Permissions
+		bit int
+	}{
+		{PermissionManageChannel, 0},
+		{PermissionManageServer, 1},
+		{PermissionManagePermissions, 2},
+		{PermissionManageRoles, 3},
+		{PermissionManageCustomisation, 4},
+		{PermissionKickMembers, 6},
+		{PermissionBanMembers, 7},
+		{PermissionTimeoutMembers, 8},
+		{PermissionAssignRoles, 9},
+		{PermissionChangeNickname, 10},
+		{PermissionManageNicknames, 11},
+		{PermissionChangeAvatar, 12},
+		{PermissionRemoveAvatars, 13},
+		{PermissionViewChannel, 20},
+		{PermissionReadMessageHistory, 21},
+		{PermissionSendMessages, 22},
+		{PermissionManageMessages, 23},
+		{PermissionManageWebhooks, 24},
+		{PermissionInviteOthers, 25},
+		{PermissionSendEmbeds, 26},
+		{PermissionUploadFiles, 27},
+		{PermissionMasquerade, 28},
+		{PermissionReact, 29},
+		{PermissionConnect, 30},
+		{PermissionSpeak, 31},
+		{PermissionVideo, 32},
+		{PermissionMuteMembers, 33},
+		{PermissionDeafenMembers, 34},
+		{PermissionMoveMembers, 35},
+	}
+	for _, tt := range tests {
+		if tt.p != 1<<tt.bit {
+			t.Errorf("%v is %#x, want bit %d", tt.p, int64(tt.p), tt.bit)
+		}
+	}
+}
+
+func TestPermissionsString(t *testing.T) {
+	for p, want := range map[Permissions]string{
+		0:                      "0",
+		PermissionSendMessages: "SendMessages",
+		PermissionSendMessages | PermissionManageRoles:    "ManageRoles|SendMessages",
+		PermissionManageChannel | 1<<5:                    "ManageChannel|0x20",
+		1<<5 | 1<<40:                                      "0x10000000020",
+		-1 << 63:                                          "0x8000000000000000",
+		PermissionsDefaultViewOnly:                        "ViewChannel|ReadMessageHistory",
+		PermissionsAllowInTimeout | PermissionMoveMembers: "ViewChannel|ReadMessageHistory|MoveMembers",
+	} {
+		if got := p.String(); got != want {
+			t.Errorf("%#x formatted as %q, want %q", int64(p), got, want)
+		}
+	}
+}
+
+func TestParsePermissions(t *testing.T) {
+	for _, p := range []Permissions{0, PermissionReact, PermissionsDefaultServer, PermissionsAll, PermissionGrantAllSafe,
+		PermissionsAll | 1<<5 | 1<<50, -1 << 63, -1} {
+		if got, err := ParsePermissions(p.String()); err != nil || got != p {
+			t.Errorf("round trip of %#x through %q: %#x, %v", int64(p), p.String(), int64(got), err)
+		}
+	}
+	for s, want := range map[string]Permissions{
+		"":                           0,
+		" | , ":                      0,
+		"sendmessages, ViewChannel":  PermissionSendMessages | PermissionViewChannel,
+		"React|0x20":                 PermissionReact | 1<<5,
+		"4194304":                    PermissionSendMessages,
+		"0b1 | 0o2":                  PermissionManageChannel | PermissionManageServer,
+		" kickMembers ,, BANMEMBERS": PermissionKickMembers | PermissionBanMembers,
+	} {
+		if got, err := ParsePermissions(s); err != nil || got != want {
+			t.Errorf("ParsePermissions(%q) = %v, %v; want %v", s, got, err, want)
+		}
+	}
+	for s, name := range map[string]string{
+		"Send Messages":       "Send Messages",
+		"React|Fly":           "Fly",
+		"0x10000000000000000": "0x10000000000000000",
+		"SendMessages;React":  "SendMessages;React",
+	} {
+		var up UnknownPermission
+		if got, err := ParsePermissions(s); !errors.As(err, &up) || up.Name != name || got != 0 {
+			t.Errorf("ParsePermissions(%q) = %v, %v; want unknown %q", s, got, err, name)
+		}
+	}
+}
+
+func TestPermissionsJSON(t *testing.T) {
+	for _, p := range []Permissions{0, PermissionsDefault, PermissionsAll | 1<<5, -1 << 63} {
+		b, err := json.Marshal(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := strconv.FormatInt(int64(p), 10); string(b) != want {
+			t.Errorf("%v marshaled as %s, want %s", p, b, want)
+		}
+		var got Permissions
+		if err := json.Unmarshal(b, &got); err != nil || got != p {
+			t.Errorf("round trip of %v: %v, %v", p, got, err)
+		}
+		if err := json.Unmarshal([]byte(strconv.Quote(p.String())), &got); err != nil || got != p {
+			t.Errorf("unmarshaling %q: %v, %v", p.String(), got, err)
+		}
+	}
+	var o PermissionOverride
+	if err := json.Unmarshal([]byte(`{"a":"SendMessages|react","d":1}`), &o); err != nil ||
+		o != (PermissionOverride{Allow: PermissionSendMessages | PermissionReact, Disallow: PermissionManageChannel}) {
+		t.Fatalf("override: %+v, %v", o, err)
+	}
+	var p Permissions
+	if err := json.Unmarshal([]byte(`"Fly"`), &p); !errors.As(err, &UnknownPermission{}) {
+		t.Errorf("unknown name: %v", err)
+	}
+	for _, in := range []string{`true`, `1.5`, `[]`, `"unterminated`} {
+		if err := json.Unmarshal([]byte(in), &p); err == nil {
+			t.Errorf("unmarshaled %s", in)
+		}
+	}
+}
@@ -0,0 +1,208 @@
+package regolt
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RateLimiter spreads requests over time so they don't overflow Revolt's rate limits.
+// Implementations must be safe for concurrent use.
+type RateLimiter interface {
+	// Wait blocks until a request to route can be performed or ctx is done.
+	Wait(ctx context.Context, route Route) error
+	// Update records rate limit headers received in response to route.
+	Update(route Route, header http.Header)
+}
+
+type rateLimitBucket struct {
+	mu sync.Mutex
+	// -1 if unknown
+	limit int
+	// -1 if unknown
+	remaining int
+	reset     time.Time
+}
+
+// DefaultRateLimiter tracks `X-RateLimit-Bucket`, `X-RateLimit-Remaining` and `X-RateLimit-Reset-After`
+// headers per bucket and holds back requests which would overflow it.
+type DefaultRateLimiter struct {
+	mu sync.Mutex
+	// route key -> bucket name
+	routes  map[string]string
+	buckets map[string]*rateLimitBucket
+	// buckets whose window is over are dropped periodically, so buckets of deleted channels don't pile up
+	lastSweep time.Time
+}
+
+// How often DefaultRateLimiter drops buckets whose window is over.
+const rateLimitSweepInterval = time.Minute
+
+func NewDefaultRateLimiter() *DefaultRateLimiter {
+	return &DefaultRateLimiter{
+		routes:  map[string]string{},
+		buckets: map[string]*rateLimitBucket{},
+	}
+}
+
+// Segments following these ones are parameters even though they aren't ULIDs.
+var routeParameterParents = map[string]bool{
+	"invites":   true,
+	"reactions": true,
+	"verify":    true,
+	"session":   true,
+	"emoji":     true,
+}
+
+// Returns route with parameters replaced by placeholders, e.g. `DELETE /channels/:id/messages/:id`,
+// so the count of keys doesn't grow with count of entities.
+func (route Route) key() string {
+	a := strings.Split(route.Path, "/")
+	for i, s := range a {
+		switch {
+		case i > 0 && routeParameterParents[a[i-1]],
+			// webhook token
+			i == 3 && a[1] == "webhooks":
+			a[i] = ":param"
+		case len(s) == ulidLength:
+			if _, err := ParseULID(s); err == nil {
+				a[i] = ":id"
+			}
+		}
+	}
+	return route.Method + " " + strings.Join(a, "/")
+}
+
+// Returns resource the route operates on, e.g. `channels/01H...` for `/channels/01H.../messages`.
+func (route Route) majorParameter() string {
+	a := strings.SplitN(strings.TrimLeft(route.Path, "/"), "/", 3)
+	if len(a) < 2 {
+		return a[0]
+	}
+	return a[0] + "/" + a[1]
+}
+
+func (rl *DefaultRateLimiter) getBucket(key string) *rateLimitBucket {
+	b, ok := rl.buckets[key]
+	if !ok {
+		b = &rateLimitBucket{limit: -1, remaining: -1}
+		rl.buckets[key] = b
+	}
+	return b
+}
+
+// Drops buckets whose window is over, must be called with rl.mu held.
+func (rl *DefaultRateLimiter) sweep(now time.Time) {
+	if now.Sub(rl.lastSweep) < rateLimitSweepInterval {
+		return
+	}
+	rl.lastSweep = now
+	for k, b := range rl.buckets {
+		// bucket is in use, skip it
+		if !b.mu.TryLock() {
+			continue
+		}
+		if b.reset.IsZero() || !now.Before(b.reset) {
+			delete(rl.buckets, k)
+		}
+		b.mu.Unlock()
+	}
+}
+
+func (rl *DefaultRateLimiter) bucket(route Route) *rateLimitBucket {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	rl.sweep(time.Now())
+	k := route.key()
+	if name, ok := rl.routes[k]; ok {
+		return rl.getBucket(name + ":" + route.majorParameter())
+	}
+	return rl.getBucket(k)
+}
+
+func (rl *DefaultRateLimiter) Wait(ctx context.Context, route Route) error {
+	b := rl.bucket(route)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for {
+		now := time.Now()
+		if !b.reset.IsZero() && !now.Before(b.reset) {
+			// window is over
+			b.remaining = b.limit
+			b.reset = time.Time{}
+		}
+		if b.remaining != 0 || b.reset.IsZero() {
+			if b.remaining > 0 {
+				b.remaining--
+			}
+			return nil
+		}
+		d := b.reset.Sub(now)
+		b.mu.Unlock()
+		err := sleepContext(ctx, d)
+		b.mu.Lock()
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (rl *DefaultRateLimiter) Update(route Route, header http.Header) {
+	name := header.Get("X-RateLimit-Bucket")
+	remaining, err := strconv.Atoi(header.Get("X-RateLimit-Remaining"))
+	if len(name) == 0 || err != nil {
+		return
+	}
+	limit, err := strconv.Atoi(header.Get("X-RateLimit-Limit"))
+	if err != nil {
+		limit = -1
+	}
+	resetAfter, err := strconv.ParseFloat(header.Get("X-RateLimit-Reset-After"), 64)
+	if err != nil {
+		return
+	}
+	rl.mu.Lock()
+	rl.routes[route.key()] = name
+	b := rl.getBucket(name + ":" + route.majorParameter())
+	rl.mu.Unlock()
+
+	reset := time.Now().Add(time.Duration(resetAfter * float64(time.Millisecond)))
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.limit = limit
+	// responses may come out of order, so trust the header only if it is more pessimistic
+	// than our local state or it opens a new window
+	if b.remaining < 0 || remaining < b.remaining || reset.Sub(b.reset) > time.Second {
+		b.remaining = remaining
+	}
+	if reset.After(b.reset) {
+		b.reset = reset
+	}
+}
+
+func retryAfter(err error, header http.Header) time.Duration {
+	var rl ErrRateLimited
+	if errors.As(err, &rl) && rl.RetryAfter > 0 {
+		return rl.RetryAfter
+	}
+	if f, err := strconv.ParseFloat(header.Get("X-RateLimit-Reset-After"), 64); err == nil {
+		return time.Duration(f * float64(time.Millisecond))
+	}
+	return time.Second
+}
+
+// Sleeps for d, returns early with ctx.Err() if ctx is done.
+func sleepContext(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
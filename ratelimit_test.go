@@ -0,0 +1,50 @@
+package regolt
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestRouteKey(t *testing.T) {
+	const id1, id2 = ULID("01ARZ3NDEKTSV4RRFFQ69G5FAV"), ULID("01ARZ3NDEKTSV4RRFFQ69G5FAW")
+	for _, c := range []struct {
+		route Route
+		want  string
+	}{
+		{RouteFetchSelf(), "GET /users/@me"},
+		{RouteFetchUser(id1), "GET /users/:id"},
+		{RouteDeleteMessage(id1, id2), "DELETE /channels/:id/messages/:id"},
+		{RouteAddReactionToMessage(id1, id2, Emoji{Emoji: "👍"}), "PUT /channels/:id/messages/:id/reactions/:param"},
+		{RouteFetchInvite("abcdef"), "GET /invites/:param"},
+		{RouteExecuteWebhook(id1, "token"), "POST /webhooks/:id/:param"},
+	} {
+		if got := c.route.key(); got != c.want {
+			t.Errorf("%s %s: got %q, want %q", c.route.Method, c.route.Path, got, c.want)
+		}
+	}
+}
+
+func TestDefaultRateLimiterDropsExpiredBuckets(t *testing.T) {
+	rl := NewDefaultRateLimiter()
+	h := http.Header{}
+	h.Set("X-RateLimit-Bucket", "messages")
+	h.Set("X-RateLimit-Limit", "10")
+	h.Set("X-RateLimit-Remaining", "9")
+	h.Set("X-RateLimit-Reset-After", "0")
+	for _, c := range []ULID{"01ARZ3NDEKTSV4RRFFQ69G5FAV", "01ARZ3NDEKTSV4RRFFQ69G5FAW", "01ARZ3NDEKTSV4RRFFQ69G5FAX"} {
+		rl.Update(RouteSendMessage(c), h)
+	}
+	if len(rl.routes) != 1 {
+		t.Errorf("expected 1 route, got %d", len(rl.routes))
+	}
+	if len(rl.buckets) != 3 {
+		t.Fatalf("expected 3 buckets, got %d", len(rl.buckets))
+	}
+	rl.mu.Lock()
+	rl.sweep(time.Now().Add(rateLimitSweepInterval))
+	rl.mu.Unlock()
+	if len(rl.buckets) != 0 {
+		t.Errorf("expected expired buckets to be dropped, got %d", len(rl.buckets))
+	}
+}
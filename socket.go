@@ -2,8 +2,10 @@ package regolt
 
 import (
 	"encoding/json"
+	"errors"
 	"log/slog"
 	"math"
+	"math/rand"
 	"net/http"
 	"net/url"
 	"os"
@@ -509,8 +511,31 @@ type Auth struct {
 	ExcludeSessionID string `json:"exclude_session_id,omitempty"`
 }
 
+// Connection to the gateway was lost.
+type Disconnected struct {
+	// Error which caused disconnect
+	Err error
+}
+
+// Socket is about to attempt to reconnect.
+type Reconnecting struct {
+	// Attempt number, starting from 1
+	Attempt int
+	// Delay before this attempt
+	Delay time.Duration
+}
+
+// Socket has reconnected and received Ready again.
+type Resumed struct {
+	// Number of attempts it took to reconnect
+	Attempts int
+}
+
 type Events struct {
 	Error         *EventController[error]
+	Disconnected  *EventController[*Disconnected]
+	Reconnecting  *EventController[*Reconnecting]
+	Resumed       *EventController[*Resumed]
 	RevoltError   *EventController[string]
 	Authenticated *EventController[*Authenticated]
 	Raw           *EventController[map[string]any]
@@ -559,6 +584,9 @@ type Events struct {
 
 func (e *Events) init() {
 	e.Error = NewEventController[error]()
+	e.Disconnected = NewEventController[*Disconnected]()
+	e.Reconnecting = NewEventController[*Reconnecting]()
+	e.Resumed = NewEventController[*Resumed]()
 	e.RevoltError = NewEventController[string]()
 	e.Authenticated = NewEventController[*Authenticated]()
 	e.Raw = NewEventController[map[string]any]()
@@ -600,29 +628,198 @@ func (e *Events) init() {
 	e.Auth = NewEventController[*Auth]()
 }
 
-type Socket struct {
-	Token       string
-	Dialer      WebsocketDialer
-	Connection  *websocket.Conn
-	URL         *url.URL
-	Me          *User
-	Events      Events
-	closed      bool
-	lastPingReq time.Time
-	lastPingRes time.Time
-	ticker      *time.Ticker
-	closeEvent  chan struct{}
-	mu          sync.Mutex
-	Cache       *GenericCache
-	Logger      *slog.Logger
-	Arshaler    JSONArshaler
+type SocketState int
+
+const (
+	// Socket was never opened or gave up reconnecting
+	SocketStateDisconnected SocketState = iota
+	// Socket is opening connection and waiting for Ready
+	SocketStateConnecting
+	// Socket received Ready and processes events
+	SocketStateConnected
+	// Connection was lost and socket is trying to establish it again
+	SocketStateReconnecting
+	// Socket was closed by user
+	SocketStateClosed
+)
+
+func (s SocketState) String() string {
+	switch s {
+	case SocketStateDisconnected:
+		return "Disconnected"
+	case SocketStateConnecting:
+		return "Connecting"
+	case SocketStateConnected:
+		return "Connected"
+	case SocketStateReconnecting:
+		return "Reconnecting"
+	case SocketStateClosed:
+		return "Closed"
+	}
+	return ""
+}
+
+// Controls how socket reconnects after connection is lost.
+type ReconnectConfig struct {
+	// Do not reconnect at all
+	Disable bool
+	// Maximum number of reconnect attempts, defaults to 10.
+	// Pass negative value to try forever.
+	MaxAttempts int
+	// Delay before first attempt, defaults to 1 second. Doubled after every failed attempt.
+	BaseDelay time.Duration
+	// Upper bound of delay, defaults to 2 minutes.
+	MaxDelay time.Duration
+	// Fraction of delay which is randomized, in range [0, 1].
+	Jitter float64
+	// Called when socket gives up reconnecting, with last error
+	OnGiveUp func(error)
+}
+
+var DefaultReconnectConfig = ReconnectConfig{
+	MaxAttempts: 10,
+	BaseDelay:   time.Second,
+	MaxDelay:    2 * time.Minute,
+	Jitter:      0.2,
+}
+
+func (rc *ReconnectConfig) delay(attempt int) time.Duration {
+	d := rc.BaseDelay
+	for i := 1; i < attempt && d < rc.MaxDelay; i++ {
+		d *= 2
+	}
+	d = min(d, rc.MaxDelay)
+	if rc.Jitter > 0 {
+		j := time.Duration(float64(d) * min(rc.Jitter, 1))
+		if j > 0 {
+			d = d - j + time.Duration(rand.Int63n(int64(2*j)))
+		}
+	}
+	return d
 }
 
+type Socket struct {
+	Token      string
+	Dialer     WebsocketDialer
+	Connection *websocket.Conn
+	URL        *url.URL
+	// Current user, set on Ready. Use Self and SetSelf when socket is running.
+	Me *User
+	// guards Me
+	meMu      sync.RWMutex
+	Events    Events
+	Reconnect ReconnectConfig
+	// How often Ping is sent
+	HeartbeatInterval time.Duration
+	// How many pings may stay unanswered before connection is considered dead
+	MaxMissedHeartbeats int
+	// guards lastPingReq, lastPingRes, missedHeartbeats and latencies
+	pingMu           sync.Mutex
+	lastPingReq      time.Time
+	lastPingRes      time.Time
+	missedHeartbeats int
+	// ring buffer of latency samples
+	latencies     []time.Duration
+	latencyCursor int
+	latencyCount  int
+	// guards state, done and shutdown
+	stateMu sync.Mutex
+	state   SocketState
+	// closed when goroutines of current connection must stop
+	done chan struct{}
+	// closed when user closes socket
+	shutdown chan struct{}
+	// tracks listener and pinger goroutines
+	wg       sync.WaitGroup
+	mu       sync.Mutex
+	Cache    *GenericCache
+	Logger   *slog.Logger
+	Arshaler JSONArshaler
+}
+
+// Current state of the socket.
+func (socket *Socket) State() SocketState {
+	socket.stateMu.Lock()
+	defer socket.stateMu.Unlock()
+	return socket.state
+}
+
+func (socket *Socket) setState(state SocketState) {
+	socket.stateMu.Lock()
+	socket.state = state
+	socket.stateMu.Unlock()
+}
+
+// Returns current user, nil until Ready is received.
+func (socket *Socket) Self() *User {
+	socket.meMu.RLock()
+	defer socket.meMu.RUnlock()
+	return socket.Me
+}
+
+// Sets current user, e.g. when it was fetched via API before connecting.
+func (socket *Socket) SetSelf(u *User) {
+	socket.meMu.Lock()
+	socket.Me = u
+	socket.meMu.Unlock()
+}
+
+// Latest measured round trip time, 0 if nothing was measured yet.
 func (socket *Socket) Latency() time.Duration {
-	if socket.lastPingReq.IsZero() || socket.lastPingRes.IsZero() {
+	socket.pingMu.Lock()
+	defer socket.pingMu.Unlock()
+	if socket.latencyCount == 0 {
 		return 0
 	}
-	return socket.lastPingRes.Sub(socket.lastPingReq)
+	n := len(socket.latencies)
+	return socket.latencies[(socket.latencyCursor+n-1)%n]
+}
+
+// Measured round trip times, from oldest to newest.
+func (socket *Socket) LatencyHistory() []time.Duration {
+	socket.pingMu.Lock()
+	defer socket.pingMu.Unlock()
+	n := len(socket.latencies)
+	r := make([]time.Duration, 0, socket.latencyCount)
+	for i := socket.latencyCount; i > 0; i-- {
+		r = append(r, socket.latencies[(socket.latencyCursor+n-i)%n])
+	}
+	return r
+}
+
+// Mean of measured round trip times, 0 if nothing was measured yet.
+func (socket *Socket) AverageLatency() time.Duration {
+	h := socket.LatencyHistory()
+	if len(h) == 0 {
+		return 0
+	}
+	var sum time.Duration
+	for _, l := range h {
+		sum += l
+	}
+	return sum / time.Duration(len(h))
+}
+
+// Number of pings sent on current connection which were not answered yet.
+func (socket *Socket) MissedHeartbeats() int {
+	socket.pingMu.Lock()
+	defer socket.pingMu.Unlock()
+	return socket.missedHeartbeats
+}
+
+func (socket *Socket) pong() {
+	socket.pingMu.Lock()
+	defer socket.pingMu.Unlock()
+	socket.lastPingRes = time.Now()
+	socket.missedHeartbeats = 0
+	if socket.lastPingReq.IsZero() || len(socket.latencies) == 0 {
+		return
+	}
+	socket.latencies[socket.latencyCursor] = socket.lastPingRes.Sub(socket.lastPingReq)
+	socket.latencyCursor = (socket.latencyCursor + 1) % len(socket.latencies)
+	if socket.latencyCount < len(socket.latencies) {
+		socket.latencyCount++
+	}
 }
 
 func (socket *Socket) LatencyMs() float64 {
@@ -637,18 +834,42 @@ func (socket *Socket) Close() error {
 	return socket.CloseWithCode(websocket.CloseNormalClosure)
 }
 
-func (socket *Socket) close() error {
-	socket.closed = true
-	socket.closeEvent <- struct{}{}
-	socket.ticker.Stop()
-	return nil
+// Stops goroutines of current connection. Returns false if they were already stopped.
+// Must be called with stateMu held.
+func (socket *Socket) teardown() bool {
+	if socket.done == nil {
+		return false
+	}
+	select {
+	case <-socket.done:
+		return false
+	default:
+		close(socket.done)
+		return true
+	}
 }
 
 func (socket *Socket) CloseWithCode(closeCode int) error {
-	if err := socket.close(); err != nil {
-		return err
+	socket.stateMu.Lock()
+	previous := socket.state
+	if previous == SocketStateClosed {
+		socket.stateMu.Unlock()
+		return nil
 	}
-	return socket.Connection.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(closeCode, ""))
+	socket.state = SocketStateClosed
+	socket.teardown()
+	close(socket.shutdown)
+	socket.stateMu.Unlock()
+	socket.mu.Lock()
+	conn := socket.Connection
+	socket.mu.Unlock()
+	// there is no live connection to close
+	if conn == nil || previous == SocketStateDisconnected || previous == SocketStateReconnecting {
+		return nil
+	}
+	err := socket.WriteRaw(websocket.CloseMessage, websocket.FormatCloseMessage(closeCode, ""))
+	conn.Close()
+	return err
 }
 
 // Generate by:
@@ -659,6 +880,18 @@ func (socket *Socket) OnError(f func(error)) *Subscription[error] {
 	return socket.Events.Error.Listen(f)
 }
 
+func (socket *Socket) OnDisconnected(f func(*Disconnected)) *Subscription[*Disconnected] {
+	return socket.Events.Disconnected.Listen(f)
+}
+
+func (socket *Socket) OnReconnecting(f func(*Reconnecting)) *Subscription[*Reconnecting] {
+	return socket.Events.Reconnecting.Listen(f)
+}
+
+func (socket *Socket) OnResumed(f func(*Resumed)) *Subscription[*Resumed] {
+	return socket.Events.Resumed.Listen(f)
+}
+
 func (socket *Socket) OnRevoltError(f func(string)) *Subscription[string] {
 	return socket.Events.RevoltError.Listen(f)
 }
@@ -829,6 +1062,14 @@ type SocketConfig struct {
 	DisableLogging bool
 	LoggerLevel    slog.Leveler
 	Arshaler       JSONArshaler
+	// Defaults to DefaultReconnectConfig
+	Reconnect *ReconnectConfig
+	// How often Ping is sent, defaults to 30 seconds
+	HeartbeatInterval time.Duration
+	// How many pings may stay unanswered before connection is closed and reopened, defaults to 2
+	MaxMissedHeartbeats int
+	// How many latency samples are kept, defaults to 10
+	LatencyHistorySize int
 }
 
 func NewSocket(token string, config *SocketConfig) (socket *Socket, err error) {
@@ -865,14 +1106,43 @@ func NewSocket(token string, config *SocketConfig) (socket *Socket, err error) {
 	if arshaler == nil {
 		arshaler = NewJSONArshaler(json.Marshal, json.Unmarshal)
 	}
+	reconnect := DefaultReconnectConfig
+	if config.Reconnect != nil {
+		reconnect = *config.Reconnect
+		if reconnect.MaxAttempts == 0 {
+			reconnect.MaxAttempts = DefaultReconnectConfig.MaxAttempts
+		}
+		if reconnect.BaseDelay <= 0 {
+			reconnect.BaseDelay = DefaultReconnectConfig.BaseDelay
+		}
+		if reconnect.MaxDelay <= 0 {
+			reconnect.MaxDelay = DefaultReconnectConfig.MaxDelay
+		}
+	}
+	heartbeatInterval := config.HeartbeatInterval
+	if heartbeatInterval <= 0 {
+		heartbeatInterval = 30 * time.Second
+	}
+	maxMissedHeartbeats := config.MaxMissedHeartbeats
+	if maxMissedHeartbeats <= 0 {
+		maxMissedHeartbeats = 2
+	}
+	latencyHistorySize := config.LatencyHistorySize
+	if latencyHistorySize <= 0 {
+		latencyHistorySize = 10
+	}
 	socket = &Socket{
-		Token:      token,
-		Dialer:     d,
-		closeEvent: make(chan struct{}),
-		URL:        wsUrl,
-		Cache:      cache,
-		Logger:     logger,
-		Arshaler:   arshaler,
+		Token:               token,
+		Dialer:              d,
+		URL:                 wsUrl,
+		Reconnect:           reconnect,
+		HeartbeatInterval:   heartbeatInterval,
+		MaxMissedHeartbeats: maxMissedHeartbeats,
+		latencies:           make([]time.Duration, latencyHistorySize),
+		shutdown:            make(chan struct{}),
+		Cache:               cache,
+		Logger:              logger,
+		Arshaler:            arshaler,
 	}
 	socket.init()
 	return
@@ -902,6 +1172,8 @@ func (s *Socket) logWarn(msg string, args ...any) {
 	}
 }
 
+var ErrConnectionLost = errors.New("connection lost before Ready was received")
+
 type SocketError struct {
 	ErrorID string
 }
@@ -933,36 +1205,34 @@ func (socket *Socket) Connect() error {
 		return err
 	}
 	conn.SetCloseHandler(func(code int, message string) error {
+		// listener will see the close error and reconnect unless socket was closed by user
 		socket.logDebug("received close message with code/message", slog.Int("code", code), slog.String("message", message))
-		if socket.closed {
-			socket.logDebug("socket was closed, returning")
-			return nil
-		}
-		socket.logDebug("closing socket internals")
-		if err := socket.close(); err != nil {
-			socket.logError("caught an error when closing", slog.Any("err", err))
-			return err
-		}
-		// reinitialize
-		socket.lastPingReq = time.Time{}
-		socket.lastPingRes = time.Time{}
-		socket.logDebug("reopening")
-		return socket.Open()
+		return nil
 	})
+	socket.mu.Lock()
 	socket.Connection = conn
+	socket.mu.Unlock()
 	return nil
 }
 
+// WriteRaw writes raw message to current connection.
+func (socket *Socket) WriteRaw(messageType int, data []byte) error {
+	socket.mu.Lock()
+	defer socket.mu.Unlock()
+	if socket.Connection == nil {
+		return websocket.ErrCloseSent
+	}
+	return socket.Connection.WriteMessage(messageType, data)
+}
+
 func (socket *Socket) Write(typ string, d map[string]any) error {
 	e := d
 	e["type"] = typ
-	socket.mu.Lock()
-	defer socket.mu.Unlock()
 	b, err := socket.marshal(e)
 	if err != nil {
 		return err
 	}
-	return socket.Connection.WriteMessage(websocket.TextMessage, b)
+	return socket.WriteRaw(websocket.TextMessage, b)
 }
 
 func (socket *Socket) Authenticate() error {
@@ -978,7 +1248,9 @@ func (socket *Socket) EndTyping(channel ULID) error {
 }
 
 func (socket *Socket) Ping() error {
+	socket.pingMu.Lock()
 	socket.lastPingReq = time.Now()
+	socket.pingMu.Unlock()
 	return socket.Write("Ping", map[string]any{"data": 0})
 }
 
@@ -987,17 +1259,25 @@ func (socket *Socket) emitError(err error) {
 	socket.Events.Error.EmitInGoroutines(err)
 }
 
-func (socket *Socket) pinger() {
+func (socket *Socket) pinger(conn *websocket.Conn, done chan struct{}, ticker *time.Ticker) {
+	defer socket.wg.Done()
+	defer ticker.Stop()
 	for {
 		select {
-		case <-socket.closeEvent:
+		case <-done:
 			return
-		case _, d := <-socket.ticker.C:
-			if !d {
-				return
-			}
+		case <-ticker.C:
 		}
+		socket.pingMu.Lock()
 		if socket.lastPingRes.Before(socket.lastPingReq) {
+			socket.missedHeartbeats++
+		}
+		missed := socket.missedHeartbeats
+		socket.pingMu.Unlock()
+		if socket.MaxMissedHeartbeats > 0 && missed >= socket.MaxMissedHeartbeats {
+			// closing connection makes listener fail on read and reconnect
+			socket.logWarn("heartbeat timed out, closing connection", slog.Int("missed", missed))
+			conn.Close()
 			return
 		}
 		if err := socket.Ping(); err != nil {
@@ -1007,68 +1287,123 @@ func (socket *Socket) pinger() {
 	}
 }
 
-func (socket *Socket) Open() (err error) {
+func (socket *Socket) Open() error {
+	return socket.open(false)
+}
+
+// Returned by open when socket was closed while reconnect attempt was waiting.
+var errReconnectCancelled = errors.New("reconnect cancelled")
+
+// Same as Open, but if fromReconnect is true, only connects if socket is still reconnecting,
+// so socket closed by user isn't reopened by pending reconnect.
+func (socket *Socket) open(fromReconnect bool) (err error) {
+	socket.stateMu.Lock()
+	if fromReconnect && socket.state != SocketStateReconnecting {
+		socket.stateMu.Unlock()
+		return errReconnectCancelled
+	}
+	switch socket.state {
+	case SocketStateConnecting, SocketStateConnected:
+		socket.stateMu.Unlock()
+		return nil
+	case SocketStateClosed:
+		socket.shutdown = make(chan struct{})
+	}
+	reconnecting := socket.state == SocketStateReconnecting
+	socket.state = SocketStateConnecting
+	socket.stateMu.Unlock()
+	defer func() {
+		if err == nil {
+			return
+		}
+		// failed attempt of reconnect leaves socket reconnecting, so Open called meanwhile connects
+		socket.stateMu.Lock()
+		if socket.state == SocketStateConnecting {
+			if reconnecting {
+				socket.state = SocketStateReconnecting
+			} else {
+				socket.state = SocketStateDisconnected
+			}
+		}
+		socket.stateMu.Unlock()
+	}()
+
 	err = socket.Connect()
 	if err != nil {
 		return
 	}
-	readyEvent := make(chan struct{})
-	errorEvent := make(chan error)
+	readyEvent := make(chan struct{}, 1)
+	errorEvent := make(chan error, 1)
 	sub1 := socket.Events.Ready.Listen(func(_ *Ready) {
-		readyEvent <- struct{}{}
+		select {
+		case readyEvent <- struct{}{}:
+		default:
+		}
 	})
 	defer sub1.Delete()
 	sub2 := socket.Events.RevoltError.Listen(func(errorID string) {
-		errorEvent <- &SocketError{ErrorID: errorID}
+		select {
+		case errorEvent <- &SocketError{ErrorID: errorID}:
+		default:
+		}
 	})
 	defer sub2.Delete()
 	sub3 := socket.Events.Error.Listen(func(err error) {
-		errorEvent <- err
+		select {
+		case errorEvent <- err:
+		default:
+		}
 	})
 	defer sub3.Delete()
 	socket.logInfo("authenticating")
 	err = socket.Authenticate()
 	if err != nil {
+		socket.Connection.Close()
 		return
 	}
 	socket.Listen()
+	socket.stateMu.Lock()
+	done := socket.done
+	socket.stateMu.Unlock()
 	select {
+	case <-done:
+		err = ErrConnectionLost
+		return
 	case err = <-errorEvent:
+		// stop goroutines quietly, caller decides whether to retry
+		socket.stateMu.Lock()
+		socket.teardown()
+		socket.stateMu.Unlock()
+		socket.Connection.Close()
 		return
 	case <-readyEvent:
 		socket.logInfo("ready")
 	}
+	socket.stateMu.Lock()
+	if socket.state == SocketStateConnecting {
+		socket.state = SocketStateConnected
+	}
+	socket.stateMu.Unlock()
 	return
 }
 
 func (socket *Socket) marshal(v any) ([]byte, error) {
-	if socket.Arshaler != nil {
-		b, err := socket.Arshaler.Marshal(v)
-		if _, ok := err.(*ArshalNotImplemented); !ok {
-			return b, err
-		}
-	}
-	return json.Marshal(v)
+	return arshalMarshal(socket.Arshaler, v)
 }
 
 func (socket *Socket) unmarshal(d []byte, v any) error {
-	if socket.Arshaler != nil {
-		err := socket.Arshaler.Unmarshal(d, v)
-		if _, ok := err.(*ArshalNotImplemented); !ok {
-			return err
-		}
-	}
-	return json.Unmarshal(d, v)
+	return arshalUnmarshal(socket.Arshaler, d, v)
 }
 
 func (socket *Socket) process(s []byte) {
 	socket.logDebug("processing", slog.String("payload", string(s)))
 	var a map[string]any
-	if err := json.Unmarshal(s, &a); err != nil {
+	if err := socket.unmarshal(s, &a); err != nil {
+		socket.emitError(err)
 		return
 	}
 	socket.Events.Raw.EmitInGoroutines(a)
-	typ := a["type"].(string)
+	typ, _ := a["type"].(string)
 	socket.logDebug("received", slog.String("type", typ))
 	switch typ {
 	case "Error":
@@ -1096,13 +1431,20 @@ func (socket *Socket) process(s []byte) {
 			socket.emitError(err)
 			return
 		}
-		socket.lastPingRes = time.Now()
+		socket.pong()
 	case "Ready":
 		t := &Ready{}
 		if err := socket.unmarshal(s, &t); err != nil {
 			socket.emitError(err)
 			return
 		}
+		// set before listeners are called, so they can rely on it
+		for _, u := range t.Users {
+			if u.Relationship == RelationshipStatusUser {
+				socket.SetSelf(u)
+				break
+			}
+		}
 		socket.Events.Ready.EmitAndCall(t, func(r *Ready) {
 			for _, u := range r.Users {
 				socket.Cache.Users.Set(u.ToOptimized())
@@ -1116,6 +1458,9 @@ func (socket *Socket) process(s []byte) {
 			for _, c := range r.Channels {
 				socket.Cache.Channels.Set(c.ToOptimized())
 			}
+			for _, m := range r.Members {
+				socket.Cache.Members.Set(m.ID.Server, m)
+			}
 			if r.Emojis != nil {
 				for _, e := range *r.Emojis {
 					socket.Cache.Emojis.Set(e.ToOptimized())
@@ -1164,7 +1509,8 @@ func (socket *Socket) process(s []byte) {
 					for _, e := range *r.Append.Embeds {
 						embeds = append(embeds, e.ToOptimized())
 					}
-					m.Embeds = append(m.Embeds, embeds...)
+					// cap the slice, so append won't write into array shared with earlier copies
+					m.Embeds = append(m.Embeds[:len(m.Embeds):len(m.Embeds)], embeds...)
 				}
 			})
 		})
@@ -1217,6 +1563,13 @@ func (socket *Socket) process(s []byte) {
 		}
 		socket.Events.ChannelCreate.EmitAndCall(t, func(r *Channel) {
 			socket.Cache.Channels.Set(r.ToOptimized())
+			if len(r.Server) != 0 {
+				socket.Cache.Servers.PartiallyUpdate(r.Server, func(s *OptimizedServer) {
+					if !slices.Contains(s.Channels, r.ID) {
+						s.Channels = append(s.Channels[:len(s.Channels):len(s.Channels)], r.ID)
+					}
+				})
+			}
 		})
 	case "ChannelUpdate":
 		t := &ChannelUpdate{}
@@ -1246,6 +1599,9 @@ func (socket *Socket) process(s []byte) {
 						c.Flags &= ^OptimizedChannelFlagNSFW
 					}
 				}
+				if r.Data.Permissions != nil {
+					c.Permissions = r.Data.Permissions
+				}
 				if r.Data.DefaultPermissions != nil {
 					c.DefaultPermissions = r.Data.DefaultPermissions
 				}
@@ -1273,7 +1629,7 @@ func (socket *Socket) process(s []byte) {
 			return
 		}
 		socket.Events.ChannelDelete.EmitAndCall(t, func(r *ChannelDelete) {
-			socket.Cache.Channels.Del(r.ChannelID)
+			socket.Cache.deleteChannel(r.ChannelID)
 		})
 	case "ChannelGroupJoin":
 		t := &ChannelGroupJoin{}
@@ -1281,14 +1637,24 @@ func (socket *Socket) process(s []byte) {
 			socket.emitError(err)
 			return
 		}
-		socket.Events.ChannelGroupJoin.EmitInGoroutines(t)
+		socket.Events.ChannelGroupJoin.EmitAndCall(t, func(r *ChannelGroupJoin) {
+			socket.Cache.Channels.PartiallyUpdate(r.ChannelID, func(c *OptimizedChannel) {
+				if !slices.Contains(c.Recipients, r.User) {
+					c.Recipients = append(c.Recipients[:len(c.Recipients):len(c.Recipients)], r.User)
+				}
+			})
+		})
 	case "ChannelGroupLeave":
 		t := &ChannelGroupLeave{}
 		if err := socket.unmarshal(s, &t); err != nil {
 			socket.emitError(err)
 			return
 		}
-		socket.Events.ChannelGroupLeave.EmitInGoroutines(t)
+		socket.Events.ChannelGroupLeave.EmitAndCall(t, func(r *ChannelGroupLeave) {
+			socket.Cache.Channels.PartiallyUpdate(r.ChannelID, func(c *OptimizedChannel) {
+				c.Recipients = without(c.Recipients, r.User)
+			})
+		})
 	case "ChannelStartTyping":
 		t := &ChannelStartTyping{}
 		if err := socket.unmarshal(s, &t); err != nil {
@@ -1319,11 +1685,14 @@ func (socket *Socket) process(s []byte) {
 		socket.Events.ServerCreate.EmitAndCall(t, func(r *ServerCreate) {
 			socket.Cache.Servers.Set(r.Server.ToOptimized())
 			for i, o := range r.Server.Roles {
-				socket.Cache.Roles.Set(i, o.ToOptimized(i))
+				socket.Cache.Roles.Set(r.Server.ID, o.ToOptimized(i))
 			}
 			for _, c := range r.Channels {
 				socket.Cache.Channels.Set(c.ToOptimized())
 			}
+			for _, e := range r.Emojis {
+				socket.Cache.Emojis.Set(e.ToOptimized())
+			}
 		})
 	case "ServerUpdate":
 		t := &ServerUpdate{}
@@ -1374,8 +1743,7 @@ func (socket *Socket) process(s []byte) {
 			return
 		}
 		socket.Events.ServerDelete.EmitAndCall(t, func(r *ServerDelete) {
-			socket.Cache.Roles.DelGroup(r.ServerID)
-			socket.Cache.Servers.Del(r.ServerID)
+			socket.Cache.deleteServer(r.ServerID)
 		})
 	case "ServerMemberUpdate":
 		t := &ServerMemberUpdate{}
@@ -1383,7 +1751,36 @@ func (socket *Socket) process(s []byte) {
 			socket.emitError(err)
 			return
 		}
-		socket.Events.ServerMemberUpdate.EmitInGoroutines(t)
+		socket.Events.ServerMemberUpdate.EmitAndCall(t, func(r *ServerMemberUpdate) {
+			socket.Cache.Members.PartiallyUpdate(r.ID.Server, r.ID.User, func(m *Member) {
+				if r.Data != nil {
+					if r.Data.Nickname != nil {
+						m.Nickname = *r.Data.Nickname
+					}
+					if r.Data.Avatar != nil {
+						m.Avatar = r.Data.Avatar
+					}
+					if r.Data.Roles != nil {
+						m.Roles = *r.Data.Roles
+					}
+					if r.Data.Timeout != nil {
+						m.Timeout = r.Data.Timeout
+					}
+				}
+				if r.IsNicknameRemoved() {
+					m.Nickname = ""
+				}
+				if r.IsAvatarRemoved() {
+					m.Avatar = nil
+				}
+				if r.IsRolesWereCleared() {
+					m.Roles = nil
+				}
+				if r.IsTimeoutRemoved() {
+					m.Timeout = nil
+				}
+			})
+		})
 	case "ServerMemberJoin":
 		t := &ServerMemberJoin{}
 		if err := socket.unmarshal(s, &t); err != nil {
@@ -1392,11 +1789,11 @@ func (socket *Socket) process(s []byte) {
 		}
 		socket.Events.ServerMemberJoin.EmitAndCall(t, func(smj *ServerMemberJoin) {
 			socket.Cache.Members.Set(smj.ServerID, &Member{
+				// join time isn't sent, it is left zero
 				ID: MemberID{
 					Server: smj.ServerID,
 					User:   smj.UserID,
 				},
-				JoinedAt: Time(time.Now()),
 			})
 		})
 	case "ServerMemberLeave":
@@ -1405,7 +1802,9 @@ func (socket *Socket) process(s []byte) {
 			socket.emitError(err)
 			return
 		}
-		socket.Events.ServerMemberLeave.EmitInGoroutines(t)
+		socket.Events.ServerMemberLeave.EmitAndCall(t, func(r *ServerMemberLeave) {
+			socket.Cache.Members.Del(r.ServerID, r.UserID)
+		})
 	case "ServerRoleUpdate":
 		t := &ServerRoleUpdate{}
 		if err := socket.unmarshal(s, &t); err != nil {
@@ -1461,7 +1860,7 @@ func (socket *Socket) process(s []byte) {
 			return
 		}
 		socket.Events.ServerRoleDelete.EmitAndCall(t, func(r *ServerRoleDelete) {
-			socket.Cache.Roles.Del(r.ServerID, r.RoleID)
+			socket.Cache.deleteRole(r.ServerID, r.RoleID)
 		})
 	case "UserUpdate":
 		t := &UserUpdate{}
@@ -1471,6 +1870,15 @@ func (socket *Socket) process(s []byte) {
 		}
 		socket.Events.UserUpdate.EmitAndCall(t, func(r *UserUpdate) {
 			socket.Cache.Users.PartiallyUpdate(r.UserID, func(u *OptimizedUser) {
+				// status and profile are shared with earlier copies
+				if u.Status != nil {
+					status := *u.Status
+					u.Status = &status
+				}
+				if u.Profile != nil {
+					profile := *u.Profile
+					u.Profile = &profile
+				}
 				if r.Data.Badges != nil {
 					u.Flags.updateBadges(*r.Data.Badges)
 				}
@@ -1635,20 +2043,30 @@ func (socket *Socket) process(s []byte) {
 	}
 }
 
-func (socket *Socket) listener() {
+func (socket *Socket) listener(conn *websocket.Conn, done chan struct{}) {
+	defer socket.wg.Done()
 	for {
-		if socket.closed {
-			return
-		}
-		m, p, err := socket.Connection.ReadMessage()
+		m, p, err := conn.ReadMessage()
 		if err != nil {
-			socket.logError("caught an error when reading message, attempting reconnect in 3s", slog.Any("err", err))
-			socket.Events.Error.Emit(err)
-			time.Sleep(3 * time.Second)
-			socket.logInfo("reconnecting")
-			if err = socket.Open(); err != nil {
-				socket.Events.Error.Emit(err)
+			socket.stateMu.Lock()
+			// connection was torn down deliberately (closed by user or failed Open)
+			if !socket.teardown() {
+				socket.stateMu.Unlock()
+				return
+			}
+			// if Open is still waiting for Ready, it reports the error itself
+			connected := socket.state == SocketStateConnected
+			if connected {
+				socket.state = SocketStateReconnecting
+			}
+			socket.stateMu.Unlock()
+			conn.Close()
+			if !connected {
+				return
 			}
+			socket.logError("caught an error when reading message", slog.Any("err", err))
+			socket.Events.Disconnected.Emit(&Disconnected{Err: err})
+			go socket.reconnect(err)
 			return
 		}
 		if m != websocket.TextMessage {
@@ -1658,8 +2076,68 @@ func (socket *Socket) listener() {
 	}
 }
 
+func (socket *Socket) reconnect(err error) {
+	// wait until previous listener and pinger exit
+	socket.wg.Wait()
+	rc := socket.Reconnect
+	if rc.Disable {
+		socket.setState(SocketStateDisconnected)
+		if rc.OnGiveUp != nil {
+			rc.OnGiveUp(err)
+		}
+		return
+	}
+	socket.stateMu.Lock()
+	shutdown := socket.shutdown
+	socket.stateMu.Unlock()
+	for attempt := 1; rc.MaxAttempts < 0 || attempt <= rc.MaxAttempts; attempt++ {
+		d := rc.delay(attempt)
+		socket.logInfo("reconnecting", slog.Int("attempt", attempt), slog.Duration("delay", d))
+		socket.Events.Reconnecting.Emit(&Reconnecting{Attempt: attempt, Delay: d})
+		t := time.NewTimer(d)
+		select {
+		case <-shutdown:
+			t.Stop()
+			return
+		case <-t.C:
+		}
+		if err = socket.open(true); err == nil {
+			socket.Events.Resumed.Emit(&Resumed{Attempts: attempt})
+			return
+		}
+		if err == errReconnectCancelled {
+			return
+		}
+		socket.logWarn("reconnect attempt failed", slog.Int("attempt", attempt), slog.Any("err", err))
+		socket.Events.Error.Emit(err)
+		socket.wg.Wait()
+	}
+	socket.logError("giving up reconnecting", slog.Any("err", err))
+	socket.stateMu.Lock()
+	if socket.state == SocketStateReconnecting {
+		socket.state = SocketStateDisconnected
+	}
+	socket.stateMu.Unlock()
+	if rc.OnGiveUp != nil {
+		rc.OnGiveUp(err)
+	}
+}
+
 func (socket *Socket) Listen() {
-	socket.ticker = time.NewTicker(30 * time.Second)
-	go socket.pinger()
-	go socket.listener()
+	socket.pingMu.Lock()
+	socket.lastPingReq = time.Time{}
+	socket.lastPingRes = time.Time{}
+	socket.missedHeartbeats = 0
+	socket.pingMu.Unlock()
+	done := make(chan struct{})
+	socket.stateMu.Lock()
+	socket.done = done
+	socket.stateMu.Unlock()
+	socket.wg.Add(2)
+	interval := socket.HeartbeatInterval
+	if interval <= 0 {
+		interval = 30 * time.Second
+	}
+	go socket.pinger(socket.Connection, done, time.NewTicker(interval))
+	go socket.listener(socket.Connection, done)
 }
@@ -0,0 +1,429 @@
+package regolt
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Minimal gateway: answers Authenticate with Ready and Ping with Pong.
+type fakeGateway struct {
+	server *httptest.Server
+	mu     sync.Mutex
+	conns  []*websocket.Conn
+	// don't answer pings
+	ignorePings atomic.Bool
+}
+
+func newFakeGateway(t *testing.T) *fakeGateway {
+	g := &fakeGateway{}
+	upgrader := websocket.Upgrader{}
+	g.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		g.mu.Lock()
+		g.conns = append(g.conns, conn)
+		g.mu.Unlock()
+		defer conn.Close()
+		for {
+			_, p, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			switch {
+			case strings.Contains(string(p), `"Authenticate"`):
+				conn.WriteMessage(websocket.TextMessage, []byte(`{"type":"Authenticated"}`))
+				conn.WriteMessage(websocket.TextMessage, []byte(`{"type":"Ready","users":[],"servers":[],"channels":[],"members":[]}`))
+			case strings.Contains(string(p), `"Ping"`) && !g.ignorePings.Load():
+				conn.WriteMessage(websocket.TextMessage, []byte(`{"type":"Pong","data":0}`))
+			}
+		}
+	}))
+	t.Cleanup(g.server.Close)
+	return g
+}
+
+func (g *fakeGateway) url() *url.URL {
+	u, _ := url.Parse("ws" + strings.TrimPrefix(g.server.URL, "http") + "/")
+	return u
+}
+
+// Drops all connections, as if network failed.
+func (g *fakeGateway) kill() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for _, c := range g.conns {
+		c.Close()
+	}
+	g.conns = nil
+}
+
+// Counts dials and fails the next `fail` of them.
+type fakeDialer struct {
+	dials atomic.Int32
+	fail  atomic.Int32
+}
+
+var errDialFailed = errors.New("dial failed")
+
+func (d *fakeDialer) Dial(wsUrl string, header http.Header) (*websocket.Conn, *http.Response, error) {
+	d.dials.Add(1)
+	if d.fail.Add(-1) >= 0 {
+		return nil, nil, errDialFailed
+	}
+	d.fail.Store(0)
+	return websocket.DefaultDialer.Dial(wsUrl, header)
+}
+
+func newConnTestSocket(t *testing.T, g *fakeGateway, d *fakeDialer, config SocketConfig) *Socket {
+	t.Helper()
+	config.URL = g.url()
+	config.Dialer = d
+	config.DisableLogging = true
+	socket, err := NewSocket("token", &config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		socket.Close()
+		socket.wg.Wait()
+	})
+	return socket
+}
+
+// Counts goroutines running function with given name, e.g. `(*Socket).listener`.
+func countGoroutines(name string) int {
+	buf := make([]byte, 1<<20)
+	buf = buf[:runtime.Stack(buf, true)]
+	return strings.Count(string(buf), "regolt."+name+"(")
+}
+
+func expectGoroutines(t *testing.T, listeners, pingers int) {
+	t.Helper()
+	// goroutines of closed connection may still be exiting
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		l, p := countGoroutines("(*Socket).listener"), countGoroutines("(*Socket).pinger")
+		if l == listeners && p == pingers {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%d listeners and %d pingers are running, want %d and %d", l, p, listeners, pingers)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func waitFor[T any](t *testing.T, ch <-chan T, what string) T {
+	t.Helper()
+	select {
+	case v := <-ch:
+		return v
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timed out waiting for %s", what)
+		panic("unreachable")
+	}
+}
+
+func TestReconnectDelay(t *testing.T) {
+	rc := ReconnectConfig{BaseDelay: time.Second, MaxDelay: 10 * time.Second}
+	for attempt, want := range []time.Duration{0, time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 10 * time.Second, 10 * time.Second} {
+		if attempt == 0 {
+			continue
+		}
+		if got := rc.delay(attempt); got != want {
+			t.Errorf("delay of attempt %d: %v, want %v", attempt, got, want)
+		}
+	}
+	rc.Jitter = 0.5
+	for i := 0; i < 100; i++ {
+		if d := rc.delay(3); d < 2*time.Second || d >= 6*time.Second {
+			t.Fatalf("delay with jitter out of range: %v", d)
+		}
+	}
+}
+
+func TestSocketReconnect(t *testing.T) {
+	g := newFakeGateway(t)
+	d := &fakeDialer{}
+	socket := newConnTestSocket(t, g, d, SocketConfig{
+		Reconnect: &ReconnectConfig{MaxAttempts: 5, BaseDelay: 10 * time.Millisecond, MaxDelay: 40 * time.Millisecond},
+	})
+	if err := socket.Open(); err != nil {
+		t.Fatal(err)
+	}
+	if s := socket.State(); s != SocketStateConnected {
+		t.Fatalf("state after Open: %v", s)
+	}
+	expectGoroutines(t, 1, 1)
+
+	var mu sync.Mutex
+	var delays []time.Duration
+	var statesAfterFailure []SocketState
+	socket.OnReconnecting(func(r *Reconnecting) {
+		mu.Lock()
+		delays = append(delays, r.Delay)
+		mu.Unlock()
+	})
+	socket.OnError(func(err error) {
+		if errors.Is(err, errDialFailed) {
+			mu.Lock()
+			statesAfterFailure = append(statesAfterFailure, socket.State())
+			mu.Unlock()
+		}
+	})
+	resumed := make(chan *Resumed, 1)
+	socket.OnResumed(func(r *Resumed) {
+		resumed <- r
+	})
+	d.fail.Store(2)
+	g.kill()
+
+	if r := waitFor(t, resumed, "Resumed"); r.Attempts != 3 {
+		t.Fatalf("resumed after %d attempts", r.Attempts)
+	}
+	if s := socket.State(); s != SocketStateConnected {
+		t.Fatalf("state after reconnect: %v", s)
+	}
+	if n := d.dials.Load(); n != 4 {
+		t.Fatalf("%d dials", n)
+	}
+	mu.Lock()
+	if want := []time.Duration{10 * time.Millisecond, 20 * time.Millisecond, 40 * time.Millisecond}; !slices.Equal(delays, want) {
+		t.Errorf("delays: %v, want %v", delays, want)
+	}
+	if want := []SocketState{SocketStateReconnecting, SocketStateReconnecting}; !slices.Equal(statesAfterFailure, want) {
+		t.Errorf("states after failed attempts: %v, want %v", statesAfterFailure, want)
+	}
+	mu.Unlock()
+	expectGoroutines(t, 1, 1)
+
+	if err := socket.Close(); err != nil {
+		t.Fatal(err)
+	}
+	expectGoroutines(t, 0, 0)
+}
+
+func TestSocketGivesUpReconnecting(t *testing.T) {
+	g := newFakeGateway(t)
+	d := &fakeDialer{}
+	gaveUp := make(chan error, 1)
+	socket := newConnTestSocket(t, g, d, SocketConfig{
+		Reconnect: &ReconnectConfig{MaxAttempts: 2, BaseDelay: time.Millisecond, OnGiveUp: func(err error) {
+			gaveUp <- err
+		}},
+	})
+	if err := socket.Open(); err != nil {
+		t.Fatal(err)
+	}
+	d.fail.Store(100)
+	g.kill()
+	if err := waitFor(t, gaveUp, "OnGiveUp"); !errors.Is(err, errDialFailed) {
+		t.Fatalf("gave up with %v", err)
+	}
+	if s := socket.State(); s != SocketStateDisconnected {
+		t.Fatalf("state after giving up: %v", s)
+	}
+	if n := d.dials.Load(); n != 3 {
+		t.Fatalf("%d dials", n)
+	}
+	expectGoroutines(t, 0, 0)
+}
+
+func TestSocketOpenBetweenReconnectAttempts(t *testing.T) {
+	g := newFakeGateway(t)
+	d := &fakeDialer{}
+	socket := newConnTestSocket(t, g, d, SocketConfig{
+		Reconnect: &ReconnectConfig{MaxAttempts: -1, BaseDelay: 50 * time.Millisecond, MaxDelay: 50 * time.Millisecond},
+	})
+	if err := socket.Open(); err != nil {
+		t.Fatal(err)
+	}
+	failed := make(chan struct{}, 1)
+	socket.OnError(func(err error) {
+		if errors.Is(err, errDialFailed) {
+			select {
+			case failed <- struct{}{}:
+			default:
+			}
+		}
+	})
+	d.fail.Store(1)
+	g.kill()
+	waitFor(t, failed, "failed reconnect attempt")
+	if s := socket.State(); s != SocketStateReconnecting {
+		t.Fatalf("state after failed attempt: %v", s)
+	}
+	dials := d.dials.Load()
+	if err := socket.Open(); err != nil {
+		t.Fatal(err)
+	}
+	if n := d.dials.Load(); n != dials+1 {
+		t.Fatalf("Open didn't connect, %d dials", n)
+	}
+	if s := socket.State(); s != SocketStateConnected {
+		t.Fatalf("state after Open: %v", s)
+	}
+	// pending reconnect attempt is cancelled
+	time.Sleep(100 * time.Millisecond)
+	if n := d.dials.Load(); n != dials+1 {
+		t.Fatalf("pending reconnect dialed, %d dials", n)
+	}
+	expectGoroutines(t, 1, 1)
+}
+
+func TestSocketCloseCancelsReconnect(t *testing.T) {
+	g := newFakeGateway(t)
+	d := &fakeDialer{}
+	socket := newConnTestSocket(t, g, d, SocketConfig{
+		Reconnect: &ReconnectConfig{MaxAttempts: 5, BaseDelay: 100 * time.Millisecond},
+	})
+	if err := socket.Open(); err != nil {
+		t.Fatal(err)
+	}
+	reconnecting := make(chan struct{}, 1)
+	socket.OnReconnecting(func(*Reconnecting) {
+		select {
+		case reconnecting <- struct{}{}:
+		default:
+		}
+	})
+	g.kill()
+	waitFor(t, reconnecting, "Reconnecting")
+	if err := socket.Close(); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(200 * time.Millisecond)
+	if s := socket.State(); s != SocketStateClosed {
+		t.Fatalf("state after Close: %v", s)
+	}
+	if n := d.dials.Load(); n != 1 {
+		t.Fatalf("socket reopened after Close, %d dials", n)
+	}
+	expectGoroutines(t, 0, 0)
+}
+
+func TestSocketClosesZombieConnection(t *testing.T) {
+	g := newFakeGateway(t)
+	g.ignorePings.Store(true)
+	d := &fakeDialer{}
+	gaveUp := make(chan error, 1)
+	socket := newConnTestSocket(t, g, d, SocketConfig{
+		HeartbeatInterval:   20 * time.Millisecond,
+		MaxMissedHeartbeats: 2,
+		Reconnect: &ReconnectConfig{Disable: true, OnGiveUp: func(err error) {
+			gaveUp <- err
+		}},
+	})
+	disconnected := make(chan *Disconnected, 1)
+	socket.OnDisconnected(func(e *Disconnected) {
+		disconnected <- e
+	})
+	start := time.Now()
+	if err := socket.Open(); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, disconnected, "Disconnected")
+	if elapsed := time.Since(start); elapsed < 2*socket.HeartbeatInterval {
+		t.Fatalf("connection closed after %v, before heartbeats were missed", elapsed)
+	}
+	waitFor(t, gaveUp, "OnGiveUp")
+	if s := socket.State(); s != SocketStateDisconnected {
+		t.Fatalf("state after heartbeat timeout: %v", s)
+	}
+	expectGoroutines(t, 0, 0)
+}
+
+func TestSocketHeartbeat(t *testing.T) {
+	g := newFakeGateway(t)
+	d := &fakeDialer{}
+	socket := newConnTestSocket(t, g, d, SocketConfig{
+		HeartbeatInterval:   10 * time.Millisecond,
+		MaxMissedHeartbeats: 1,
+		LatencyHistorySize:  3,
+	})
+	if err := socket.Open(); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for len(socket.LatencyHistory()) < 3 {
+		if time.Now().After(deadline) {
+			t.Fatalf("latency history: %v", socket.LatencyHistory())
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	// answered pings keep connection alive
+	time.Sleep(10 * socket.HeartbeatInterval)
+	if s := socket.State(); s != SocketStateConnected {
+		t.Fatalf("state: %v", s)
+	}
+	if n := d.dials.Load(); n != 1 {
+		t.Fatalf("%d dials", n)
+	}
+	if h := socket.LatencyHistory(); len(h) != 3 {
+		t.Fatalf("latency history: %v", h)
+	}
+	if socket.Latency() <= 0 || socket.AverageLatency() <= 0 {
+		t.Fatalf("latency %v, average %v", socket.Latency(), socket.AverageLatency())
+	}
+}
+
+func TestSocketLatencyHistory(t *testing.T) {
+	socket, err := NewSocket("token", &SocketConfig{DisableLogging: true, LatencyHistorySize: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l := socket.Latency(); l != 0 {
+		t.Fatalf("latency before pongs: %v", l)
+	}
+	if h := socket.LatencyHistory(); len(h) != 0 {
+		t.Fatalf("history before pongs: %v", h)
+	}
+	if !math.IsNaN(socket.LatencyMs()) {
+		t.Fatalf("latency ms before pongs: %v", socket.LatencyMs())
+	}
+	// pong without ping isn't measured
+	socket.pong()
+	if h := socket.LatencyHistory(); len(h) != 0 {
+		t.Fatalf("history after unsolicited pong: %v", h)
+	}
+	hours := func(h []time.Duration) []int {
+		r := make([]int, len(h))
+		for i, d := range h {
+			r[i] = int(d / time.Hour)
+		}
+		return r
+	}
+	for i, want := range [][]int{{1}, {1, 2}, {1, 2, 3}, {2, 3, 4}, {3, 4, 5}, {4, 5, 6}, {5, 6, 7}} {
+		socket.pingMu.Lock()
+		socket.lastPingReq = time.Now().Add(-time.Duration(i+1) * time.Hour)
+		socket.missedHeartbeats = 1
+		socket.pingMu.Unlock()
+		socket.pong()
+		if got := hours(socket.LatencyHistory()); !slices.Equal(got, want) {
+			t.Fatalf("history after %d pongs: %v, want %v", i+1, got, want)
+		}
+		if l := int(socket.Latency() / time.Hour); l != i+1 {
+			t.Fatalf("latency after %d pongs: %dh", i+1, l)
+		}
+		if n := socket.MissedHeartbeats(); n != 0 {
+			t.Fatalf("missed heartbeats after pong: %d", n)
+		}
+	}
+	if a := int(socket.AverageLatency() / time.Hour); a != 6 {
+		t.Fatalf("average latency: %dh", a)
+	}
+}
@@ -0,0 +1,273 @@
+package regolt
+
+import (
+	"reflect"
+	"slices"
+	"testing"
+	"time"
+)
+
+// Returns socket with unlimited caches, which isn't connected anywhere.
+func newTestSocket(t *testing.T) *Socket {
+	t.Helper()
+	socket, err := NewSocket("", &SocketConfig{
+		DisableLogging: true,
+		Cache: &GenericCache{
+			Channels: &Cache1[OptimizedChannel]{MaxSize: -1},
+			Emojis:   &Cache1[OptimizedCustomEmoji]{MaxSize: -1},
+			Messages: &Cache2[OptimizedMessage]{TotalMaxSize: 1000},
+			Members:  &Cache2[Member]{TotalMaxSize: 1000},
+			Roles:    &Cache2[OptimizedRole]{TotalMaxSize: 1000},
+			Servers:  &Cache1[OptimizedServer]{MaxSize: -1},
+			Users:    &Cache1[OptimizedUser]{MaxSize: -1},
+			Webhooks: &Cache1[OptimizedWebhook]{MaxSize: -1},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	socket.Events.Error.Listen(func(err error) {
+		t.Errorf("socket error: %v", err)
+	})
+	return socket
+}
+
+// Feeds raw payloads to socket. Without listeners, cache is updated synchronously.
+func replay(socket *Socket, payloads ...string) {
+	for _, p := range payloads {
+		socket.process([]byte(p))
+	}
+}
+
+// IDs of entities in each cache, sorted.
+type cacheState struct {
+	Channels []ULID
+	Emojis   []ULID
+	Servers  []ULID
+	Users    []ULID
+	Webhooks []ULID
+	Messages map[ULID][]ULID
+	Members  map[ULID][]ULID
+	Roles    map[ULID][]ULID
+}
+
+func sorted(a []ULID) []ULID {
+	if len(a) == 0 {
+		return nil
+	}
+	slices.Sort(a)
+	return a
+}
+
+func groups[T Cacheable](c *Cache2[T]) map[ULID][]ULID {
+	m := map[ULID][]ULID{}
+	for _, g := range c.Groups() {
+		m[g] = sorted(c.Keys(g))
+	}
+	return m
+}
+
+func stateOf(gc *GenericCache) cacheState {
+	return cacheState{
+		Channels: sorted(gc.Channels.Keys()),
+		Emojis:   sorted(gc.Emojis.Keys()),
+		Servers:  sorted(gc.Servers.Keys()),
+		Users:    sorted(gc.Users.Keys()),
+		Webhooks: sorted(gc.Webhooks.Keys()),
+		Messages: groups(gc.Messages),
+		Members:  groups(gc.Members),
+		Roles:    groups(gc.Roles),
+	}
+}
+
+func expectState(t *testing.T, step string, gc *GenericCache, want cacheState) {
+	t.Helper()
+	if want.Messages == nil {
+		want.Messages = map[ULID][]ULID{}
+	}
+	if want.Members == nil {
+		want.Members = map[ULID][]ULID{}
+	}
+	if want.Roles == nil {
+		want.Roles = map[ULID][]ULID{}
+	}
+	if got := stateOf(gc); !reflect.DeepEqual(got, want) {
+		t.Fatalf("%s:\ngot  %+v\nwant %+v", step, got, want)
+	}
+}
+
+func TestSocketGroupRecipients(t *testing.T) {
+	socket := newTestSocket(t)
+	replay(socket,
+		`{"type":"Ready","users":[{"_id":"u1","username":"a"},{"_id":"u2","username":"b"}],"servers":[],
+		"channels":[{"channel_type":"Group","_id":"g1","name":"group","owner":"u1","recipients":["u1"]}],"members":[]}`,
+		`{"type":"ChannelGroupJoin","id":"g1","user":"u2"}`,
+		// joining twice doesn't duplicate recipient
+		`{"type":"ChannelGroupJoin","id":"g1","user":"u2"}`,
+	)
+	if got := socket.Cache.Channels.Get("g1").Recipients; !reflect.DeepEqual(got, []ULID{"u1", "u2"}) {
+		t.Fatalf("recipients after join: %v", got)
+	}
+	replay(socket, `{"type":"ChannelGroupLeave","id":"g1","user":"u1"}`)
+	if got := socket.Cache.Channels.Get("g1").Recipients; !reflect.DeepEqual(got, []ULID{"u2"}) {
+		t.Fatalf("recipients after leave: %v", got)
+	}
+	expectState(t, "group", socket.Cache, cacheState{
+		Channels: []ULID{"g1"},
+		Users:    []ULID{"u1", "u2"},
+	})
+}
+
+// Attaches slow listeners, so cache updates would be reordered if they ran along with listeners.
+func attachSlowListeners(socket *Socket) {
+	slow := func() {
+		time.Sleep(20 * time.Millisecond)
+	}
+	socket.Events.ServerCreate.Listen(func(*ServerCreate) { slow() })
+	socket.Events.ChannelCreate.Listen(func(*Channel) { slow() })
+	socket.Events.ServerMemberJoin.Listen(func(*ServerMemberJoin) { slow() })
+	socket.Events.ServerMemberUpdate.Listen(func(*ServerMemberUpdate) { slow() })
+	socket.Events.Message.Listen(func(*Message) { slow() })
+	socket.Events.WebhookCreate.Listen(func(*Webhook) { slow() })
+	socket.Events.ChannelDelete.Listen(func(*ChannelDelete) { slow() })
+	socket.Events.ServerRoleDelete.Listen(func(*ServerRoleDelete) { slow() })
+	socket.Events.ServerMemberLeave.Listen(func(*ServerMemberLeave) { slow() })
+	socket.Events.ServerDelete.Listen(func(*ServerDelete) { slow() })
+}
+
+func TestSocketServerLifecycle(t *testing.T) {
+	t.Run("without listeners", func(t *testing.T) {
+		testSocketServerLifecycle(t, newTestSocket(t))
+	})
+	t.Run("with listeners", func(t *testing.T) {
+		socket := newTestSocket(t)
+		attachSlowListeners(socket)
+		testSocketServerLifecycle(t, socket)
+	})
+}
+
+func TestSocketCreateDeleteWithListener(t *testing.T) {
+	socket := newTestSocket(t)
+	attachSlowListeners(socket)
+	replay(socket,
+		`{"type":"ChannelCreate","channel_type":"TextChannel","_id":"c1","server":"s1","name":"general"}`,
+		`{"type":"ChannelDelete","id":"c1"}`,
+	)
+	if socket.Cache.Channels.Has("c1") {
+		t.Fatal("channel is cached after ChannelDelete")
+	}
+	time.Sleep(50 * time.Millisecond)
+	if socket.Cache.Channels.Has("c1") {
+		t.Fatal("channel is cached after listeners returned")
+	}
+}
+
+func testSocketServerLifecycle(t *testing.T, socket *Socket) {
+	gc := socket.Cache
+	replay(socket,
+		`{"type":"Ready","users":[{"_id":"u1","username":"a"},{"_id":"u2","username":"b"}],"servers":[],"channels":[],"members":[]}`,
+		`{"type":"ServerCreate","id":"s1","server":{"_id":"s1","owner":"u1","name":"server","channels":["c1"],
+		"roles":{"r1":{"name":"mod","permissions":{"a":64,"d":0},"rank":1},"r2":{"name":"member","permissions":{"a":0,"d":0},"rank":2}},
+		"default_permissions":0},
+		"channels":[{"channel_type":"TextChannel","_id":"c1","server":"s1","name":"general",
+		"role_permissions":{"r1":{"a":1,"d":0},"r2":{"a":0,"d":1}}}],
+		"emojis":[{"_id":"e1","parent":{"type":"Server","id":"s1"},"creator_id":"u1","name":"pog"}]}`,
+		`{"type":"ChannelCreate","channel_type":"TextChannel","_id":"c2","server":"s1","name":"random",
+		"role_permissions":{"r1":{"a":1,"d":0}}}`,
+		`{"type":"ServerMemberJoin","id":"s1","user":"u1"}`,
+		`{"type":"ServerMemberJoin","id":"s1","user":"u2"}`,
+		`{"type":"ServerMemberUpdate","id":{"server":"s1","user":"u1"},"data":{"nickname":"nick","roles":["r1","r2"]},"clear":[]}`,
+		`{"type":"Message","_id":"m1","channel":"c1","author":"u1","content":"hi"}`,
+		`{"type":"Message","_id":"m2","channel":"c2","author":"u2","content":"hello"}`,
+		`{"type":"WebhookCreate","id":"w1","name":"hook","channel_id":"c1","permissions":0}`,
+		`{"type":"WebhookCreate","id":"w2","name":"hook","channel_id":"c2","permissions":0}`,
+	)
+	expectState(t, "after ServerCreate", gc, cacheState{
+		Channels: []ULID{"c1", "c2"},
+		Emojis:   []ULID{"e1"},
+		Servers:  []ULID{"s1"},
+		Users:    []ULID{"u1", "u2"},
+		Webhooks: []ULID{"w1", "w2"},
+		Messages: map[ULID][]ULID{"c1": {"m1"}, "c2": {"m2"}},
+		Members:  map[ULID][]ULID{"s1": {"u1", "u2"}},
+		Roles:    map[ULID][]ULID{"s1": {"r1", "r2"}},
+	})
+	if got := gc.Servers.Get("s1").Channels; !reflect.DeepEqual(got, []ULID{"c1", "c2"}) {
+		t.Fatalf("server channels after ChannelCreate: %v", got)
+	}
+	if m := gc.Members.Get("s1", "u2"); !time.Time(m.JoinedAt).IsZero() {
+		t.Fatalf("member joined at %v, join time isn't known", m.JoinedAt)
+	}
+	m := gc.Members.Get("s1", "u1")
+	if m.Nickname != "nick" || !reflect.DeepEqual(m.Roles, []ULID{"r1", "r2"}) {
+		t.Fatalf("member after ServerMemberUpdate: %+v", m)
+	}
+
+	replay(socket, `{"type":"ServerMemberUpdate","id":{"server":"s1","user":"u1"},"data":{},"clear":["Nickname"]}`)
+	if m := gc.Members.Get("s1", "u1"); m.Nickname != "" || len(m.Roles) != 2 {
+		t.Fatalf("member after clearing nickname: %+v", m)
+	}
+
+	replay(socket, `{"type":"ChannelDelete","id":"c1"}`)
+	expectState(t, "after ChannelDelete", gc, cacheState{
+		Channels: []ULID{"c2"},
+		Emojis:   []ULID{"e1"},
+		Servers:  []ULID{"s1"},
+		Users:    []ULID{"u1", "u2"},
+		Webhooks: []ULID{"w2"},
+		Messages: map[ULID][]ULID{"c2": {"m2"}},
+		Members:  map[ULID][]ULID{"s1": {"u1", "u2"}},
+		Roles:    map[ULID][]ULID{"s1": {"r1", "r2"}},
+	})
+	if got := gc.Servers.Get("s1").Channels; !reflect.DeepEqual(got, []ULID{"c2"}) {
+		t.Fatalf("server channels after ChannelDelete: %v", got)
+	}
+
+	replay(socket, `{"type":"ServerRoleDelete","id":"s1","role_id":"r1"}`)
+	expectState(t, "after ServerRoleDelete", gc, cacheState{
+		Channels: []ULID{"c2"},
+		Emojis:   []ULID{"e1"},
+		Servers:  []ULID{"s1"},
+		Users:    []ULID{"u1", "u2"},
+		Webhooks: []ULID{"w2"},
+		Messages: map[ULID][]ULID{"c2": {"m2"}},
+		Members:  map[ULID][]ULID{"s1": {"u1", "u2"}},
+		Roles:    map[ULID][]ULID{"s1": {"r2"}},
+	})
+	if got := gc.Members.Get("s1", "u1").Roles; !reflect.DeepEqual(got, []ULID{"r2"}) {
+		t.Fatalf("member roles after ServerRoleDelete: %v", got)
+	}
+	if got := gc.Channels.Get("c2").RolePermissions; len(got) != 0 {
+		t.Fatalf("channel role permissions after ServerRoleDelete: %v", got)
+	}
+
+	replay(socket, `{"type":"ServerMemberLeave","id":"s1","user":"u2"}`)
+	expectState(t, "after ServerMemberLeave", gc, cacheState{
+		Channels: []ULID{"c2"},
+		Emojis:   []ULID{"e1"},
+		Servers:  []ULID{"s1"},
+		Users:    []ULID{"u1", "u2"},
+		Webhooks: []ULID{"w2"},
+		Messages: map[ULID][]ULID{"c2": {"m2"}},
+		Members:  map[ULID][]ULID{"s1": {"u1"}},
+		Roles:    map[ULID][]ULID{"s1": {"r2"}},
+	})
+
+	replay(socket, `{"type":"ServerDelete","id":"s1"}`)
+	expectState(t, "after ServerDelete", gc, cacheState{
+		Users: []ULID{"u1", "u2"},
+	})
+}
+
+func TestSocketReadySetsSelf(t *testing.T) {
+	socket := newTestSocket(t)
+	self := make(chan *User, 1)
+	socket.OnReady(func(*Ready) {
+		self <- socket.Self()
+	})
+	replay(socket, `{"type":"Ready","users":[{"_id":"u1","username":"a","relationship":"Friend"},
+	{"_id":"bot","username":"bot","relationship":"User","bot":{"owner":"u1"}}],"servers":[],"channels":[],"members":[]}`)
+	if me := <-self; me == nil || me.ID != "bot" || me.Bot == nil || me.Bot.Owner != "u1" {
+		t.Fatalf("self in Ready listener: %+v", me)
+	}
+}
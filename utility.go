@@ -1,5 +1,10 @@
 package regolt
 
+import (
+	"encoding/json"
+	"errors"
+)
+
 func P[T any](t T) *T {
 	return &t
 }
@@ -10,9 +15,20 @@ func (ArshalNotImplemented) Error() string {
 	return "Arshaling not implemented"
 }
 
+// Makes errors.Is(err, ArshalNotImplemented{}) match both ArshalNotImplemented and *ArshalNotImplemented.
+func (ArshalNotImplemented) Is(target error) bool {
+	switch target.(type) {
+	case ArshalNotImplemented, *ArshalNotImplemented:
+		return true
+	}
+	return false
+}
+
 type Marshal func(any) ([]byte, error)
 type Unmarshal func([]byte, any) error
 
+// JSONArshaler lets API, AutumnAPI and Socket use other JSON library, e.g.
+// `regolt.NewJSONArshaler(sonic.Marshal, sonic.Unmarshal)`.
 type JSONArshaler interface {
 	// if you want use default arshal, do `nil, ArshalNotImplemented{}`
 	Marshal(any) ([]byte, error)
@@ -32,7 +48,7 @@ func (a *jsonArshalerImpl) Marshal(t any) ([]byte, error) {
 }
 
 func (a *jsonArshalerImpl) Unmarshal(d []byte, t any) error {
-	if a.marshal != nil {
+	if a.unmarshal != nil {
 		return a.unmarshal(d, t)
 	}
 	return ArshalNotImplemented{}
@@ -42,3 +58,36 @@ func (a *jsonArshalerImpl) Unmarshal(d []byte, t any) error {
 func NewJSONArshaler(marshal Marshal, unmarshal Unmarshal) JSONArshaler {
 	return &jsonArshalerImpl{marshal, unmarshal}
 }
+
+// Returns copy of a without v.
+func without[T comparable](a []T, v T) []T {
+	r := make([]T, 0, len(a))
+	for _, x := range a {
+		if x != v {
+			r = append(r, x)
+		}
+	}
+	return r
+}
+
+// Encodes v with a, falls back to encoding/json if a is nil or returns ArshalNotImplemented.
+func arshalMarshal(a JSONArshaler, v any) ([]byte, error) {
+	if a != nil {
+		b, err := a.Marshal(v)
+		if !errors.Is(err, ArshalNotImplemented{}) {
+			return b, err
+		}
+	}
+	return json.Marshal(v)
+}
+
+// Decodes d with a, falls back to encoding/json if a is nil or returns ArshalNotImplemented.
+func arshalUnmarshal(a JSONArshaler, d []byte, v any) error {
+	if a != nil {
+		err := a.Unmarshal(d, v)
+		if !errors.Is(err, ArshalNotImplemented{}) {
+			return err
+		}
+	}
+	return json.Unmarshal(d, v)
+}
@@ -0,0 +1,149 @@
+package regolt
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"testing"
+)
+
+var errArshal = errors.New("arshal failed")
+
+// Arshaler which marks what it encoded and decoded, so fallback to encoding/json can be told apart.
+func markingArshaler(marshalErr, unmarshalErr error) JSONArshaler {
+	return NewJSONArshaler(func(any) ([]byte, error) {
+		if marshalErr != nil {
+			return nil, marshalErr
+		}
+		return []byte(`"custom"`), nil
+	}, func(_ []byte, v any) error {
+		if unmarshalErr != nil {
+			return unmarshalErr
+		}
+		*(v.(*string)) = "custom"
+		return nil
+	})
+}
+
+func TestArshalFallback(t *testing.T) {
+	tests := []struct {
+		name          string
+		arshaler      JSONArshaler
+		wantMarshal   string
+		wantUnmarshal string
+		wantErr       error
+	}{
+		{name: "nil arshaler", arshaler: nil, wantMarshal: `"value"`, wantUnmarshal: "value"},
+		{name: "marshal only", arshaler: NewJSONArshaler(markingArshaler(nil, nil).Marshal, nil), wantMarshal: `"custom"`, wantUnmarshal: "value"},
+		{name: "unmarshal only", arshaler: NewJSONArshaler(nil, markingArshaler(nil, nil).Unmarshal), wantMarshal: `"value"`, wantUnmarshal: "custom"},
+		{name: "both", arshaler: markingArshaler(nil, nil), wantMarshal: `"custom"`, wantUnmarshal: "custom"},
+		{name: "not implemented value", arshaler: markingArshaler(ArshalNotImplemented{}, ArshalNotImplemented{}), wantMarshal: `"value"`, wantUnmarshal: "value"},
+		{name: "not implemented pointer", arshaler: markingArshaler(&ArshalNotImplemented{}, &ArshalNotImplemented{}), wantMarshal: `"value"`, wantUnmarshal: "value"},
+		{name: "not implemented wrapped", arshaler: markingArshaler(fmt.Errorf("x: %w", ArshalNotImplemented{}), fmt.Errorf("x: %w", &ArshalNotImplemented{})), wantMarshal: `"value"`, wantUnmarshal: "value"},
+		{name: "real error", arshaler: markingArshaler(errArshal, errArshal), wantErr: errArshal},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, err := arshalMarshal(tt.arshaler, "value")
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("marshal error: %v, want %v", err, tt.wantErr)
+			}
+			if string(b) != tt.wantMarshal {
+				t.Fatalf("marshal: %s, want %s", b, tt.wantMarshal)
+			}
+			var s string
+			err = arshalUnmarshal(tt.arshaler, []byte(`"value"`), &s)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("unmarshal error: %v, want %v", err, tt.wantErr)
+			}
+			if s != tt.wantUnmarshal {
+				t.Fatalf("unmarshal: %q, want %q", s, tt.wantUnmarshal)
+			}
+		})
+	}
+}
+
+func TestArshalNotImplementedIs(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{ArshalNotImplemented{}, true},
+		{&ArshalNotImplemented{}, true},
+		{fmt.Errorf("wrapped: %w", ArshalNotImplemented{}), true},
+		{fmt.Errorf("wrapped: %w", &ArshalNotImplemented{}), true},
+		{errArshal, false},
+		{nil, false},
+	}
+	for _, tt := range tests {
+		for _, target := range []error{ArshalNotImplemented{}, &ArshalNotImplemented{}} {
+			if got := errors.Is(tt.err, target); got != tt.want {
+				t.Errorf("errors.Is(%#v, %#v) = %v, want %v", tt.err, target, got, tt.want)
+			}
+		}
+	}
+}
+
+// Counts calls and delegates to encoding/json.
+type countingArshaler struct {
+	marshals   atomic.Int32
+	unmarshals atomic.Int32
+}
+
+func (a *countingArshaler) Marshal(v any) ([]byte, error) {
+	a.marshals.Add(1)
+	return json.Marshal(v)
+}
+
+func (a *countingArshaler) Unmarshal(d []byte, v any) error {
+	a.unmarshals.Add(1)
+	return json.Unmarshal(d, v)
+}
+
+func TestArshalerUsedByRequesters(t *testing.T) {
+	hc := &testHTTPClient{handler: func(r *http.Request) (int, string) {
+		if r.URL.Host == "autumn.revolt.chat" {
+			return 200, `{"autumn":"1","tags":{}}`
+		}
+		return 200, `{"_id":"m1","channel":"c1","author":"u1"}`
+	}}
+
+	a := &countingArshaler{}
+	api, err := NewAPI(nil, &APIConfig{HTTPClient: hc, Arshaler: a, DisableRateLimiter: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := api.SendMessage("c1", &SendMessage{Content: "hi"}); err != nil {
+		t.Fatal(err)
+	}
+	if a.marshals.Load() == 0 || a.unmarshals.Load() == 0 {
+		t.Fatalf("API: %d marshals, %d unmarshals", a.marshals.Load(), a.unmarshals.Load())
+	}
+
+	a = &countingArshaler{}
+	autumn, err := NewAutumnAPI(nil, &AutumnAPIConfig{HTTPClient: hc, Arshaler: a})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := autumn.FetchConfig(); err != nil {
+		t.Fatal(err)
+	}
+	if a.unmarshals.Load() == 0 {
+		t.Fatal("AutumnAPI didn't use arshaler")
+	}
+
+	a = &countingArshaler{}
+	socket, err := NewSocket("", &SocketConfig{Arshaler: a, DisableLogging: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	replay(socket, `{"type":"Pong","data":0}`)
+	if a.unmarshals.Load() == 0 {
+		t.Fatal("Socket didn't use arshaler")
+	}
+	if _, err := socket.marshal(map[string]string{"type": "Ping"}); err != nil || a.marshals.Load() == 0 {
+		t.Fatalf("Socket didn't use arshaler for marshal: %v", err)
+	}
+}